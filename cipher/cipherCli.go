@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/cobra"
 	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
 )
 
 type cipherCLI struct {
 	verbose bool
 	debug   bool
+	//progress of the encryption or decryption, nil if not shown
+	progress *progressReport
 }
 
 var (
@@ -51,3 +57,62 @@ func cli() {
 
 	os.Exit(0)
 }
+
+// file path of the standard input or output
+const stdio = "-"
+
+// opens path for reading, "-" is the standard input
+func openInput(path string) (*os.File, error) {
+	if path == stdio {
+		return os.Stdin, nil
+	}
+	return os.Open(path)
+}
+
+// creates path, "-" is the standard output
+func createOutput(path string) (*os.File, error) {
+	if path == stdio {
+		return os.Stdout, nil
+	}
+	return os.Create(path)
+}
+
+// prints the status messages on stderr, stdout may be the data of a pipe. The progress bar is ended first
+func status(format string, args ...interface{}) {
+	cipherCli.progress.end()
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// prints the error of a command on stderr and exits
+func commandError(err error) {
+	status("Error: %v\n", err)
+	os.Exit(1)
+}
+
+// context cancelled on ctrl-c, the commands using it stop cleanly
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(interrupt)
+	}()
+	return ctx, cancel
+}
+
+// value of the --workers option, 0 for the number of cores
+func workersFlag(cmd *cobra.Command) (int, error) {
+	workers, err := strconv.Atoi(cmd.Flag("workers").Value.String())
+	if err != nil || workers < 0 {
+		return 0, fmt.Errorf("option --workers should be a positive number")
+	}
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	return workers, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+var EncryptDirCmd = &cobra.Command{
+	Use:   "encryptDir [sourceDirPath] [targetFilePath] [publicKeyFilePath]",
+	Short: "encrypt a directory tree in a single archive",
+	Long:  `encrypt the files, directories and symbolic links of a directory tree in a single archive, keeping their paths, modes and modification times`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.encryptDir(cmd, args); err != nil {
+			commandError(err)
+		}
+	},
+}
+
+var DecryptDirCmd = &cobra.Command{
+	Use:   "decryptDir [sourceFilePath] [targetDirPath] [privateKeyFilePath]",
+	Short: "decrypt an archive made by encryptDir",
+	Long:  `decrypt an archive made by encryptDir in a new directory, paths going out of the directory are refused`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.decryptDir(cmd, args); err != nil {
+			commandError(err)
+		}
+	},
+}
+
+var ListCmd = &cobra.Command{
+	Use:   "list [filePath] [privateKeyFilePath]",
+	Short: "list the content of an archive made by encryptDir",
+	Long:  `list the content of an archive made by encryptDir, only the index at the beginning of the archive is decrypted`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.list(cmd, args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(EncryptDirCmd)
+	RootCmd.AddCommand(DecryptDirCmd)
+	RootCmd.AddCommand(ListCmd)
+	addEncryptFlags(EncryptDirCmd)
+	addDecryptFlags(DecryptDirCmd)
+	ListCmd.Flags().Bool("allow-unauthenticated", false, `list the archives without MAC`)
+}
+
+func (m *cipherCLI) encryptDir(cmd *cobra.Command, args []string) error {
+	recipients, _ := cmd.Flags().GetStringArray("recipient")
+	if len(args) < 3 && (len(args) < 2 || len(recipients) == 0) {
+		return fmt.Errorf("usage cipher encryptDir [sourceDirPath] [targetFilePath] [publicKeyFilePath]")
+	}
+	keyPath := ""
+	if len(args) > 2 {
+		keyPath = args[2]
+	}
+	options, err := encryptOptions(cmd)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	t0 := time.Now()
+	if err := rsa.EncryptDirContext(ctx, args[0], args[1], keyPath, options); err != nil {
+		return err
+	}
+	status("done time=%ds\n", time.Now().Sub(t0).Nanoseconds()/1000000000)
+	return nil
+}
+
+func (m *cipherCLI) decryptDir(cmd *cobra.Command, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage cipher decryptDir [sourceFilePath] [targetDirPath] [privateKeyFilePath]")
+	}
+	options, err := decryptOptions(cmd)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	t0 := time.Now()
+	if err := rsa.DecryptDirContext(ctx, args[0], args[1], args[2], options); err != nil {
+		return err
+	}
+	status("done time=%ds\n", time.Now().Sub(t0).Nanoseconds()/1000000000)
+	return nil
+}
+
+func (m *cipherCLI) list(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage cipher list [filePath] [privateKeyFilePath]")
+	}
+	allowUnauthenticated, _ := cmd.Flags().GetBool("allow-unauthenticated")
+	entries, err := rsa.ListArchive(args[0], args[1], &rsa.DecryptOptions{AllowUnauthenticated: allowUnauthenticated})
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		mode := entry.Mode
+		switch entry.Type {
+		case rsa.EntryDir:
+			mode |= os.ModeDir
+		case rsa.EntrySymlink:
+			mode |= os.ModeSymlink
+		}
+		name := entry.Path
+		if entry.Type == rsa.EntrySymlink {
+			name += " -> " + entry.Target
+		}
+		fmt.Printf("%s %12d %s %s\n", mode, entry.Size, entry.ModTime.Format("2006-01-02 15:04"), name)
+	}
+	return nil
+}
@@ -24,6 +24,7 @@ var CreateKeysCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(CreateKeysCmd)
 	CreateKeysCmd.Flags().String("size", "8192", `RSA Keys size (bit) should be a multiple of 64`)
+	CreateKeysCmd.Flags().String("exponent", "random", `public exponent, random or an odd number (65537 for keys usable by crypto/tls or crypto/x509)`)
 }
 
 func (m *cipherCLI) createRSAKeys(cmd *cobra.Command, args []string) error {
@@ -36,7 +37,17 @@ func (m *cipherCLI) createRSAKeys(cmd *cobra.Command, args []string) error {
 	}
 	path := args[0]
 	t0 := time.Now()
-	publicKey, privateKey, err := rsa.CreateRSAKey(keyBitSize, m.verbose, m.debug)
+	var publicKey *rsa.PublicKey
+	var privateKey *rsa.PrivateKey
+	if exponent := cmd.Flag("exponent").Value.String(); exponent == "random" {
+		publicKey, privateKey, err = rsa.CreateRSAKey(keyBitSize, m.verbose, m.debug)
+	} else {
+		ee, erre := strconv.Atoi(exponent)
+		if erre != nil {
+			return fmt.Errorf("option --exponent is not a number")
+		}
+		publicKey, privateKey, err = rsa.CreateRSAKeyWithExponent(keyBitSize, ee, m.verbose, m.debug)
+	}
 	if err != nil {
 		return err
 	}
@@ -1,35 +1,120 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/freignat91/cipher/rsa"
 	"github.com/spf13/cobra"
+	"os"
 	"time"
 )
 
 var DecryptFileCmd = &cobra.Command{
 	Use:   "decryptFile [sourcefilePath] [targetFilePath] [privateeKeyFilePath]",
 	Short: "decrypt file",
-	Long:  `decrypt file`,
+	Long:  `decrypt file, "-" as source or target is the standard input or output`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := cipherCli.decryptFile(cmd, args); err != nil {
-			fmt.Printf("Error: %v\n", err)
+			commandError(err)
 		}
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(DecryptFileCmd)
+	addDecryptFlags(DecryptFileCmd)
+	DecryptFileCmd.Flags().Int64("offset", 0, `decrypt only from this byte of the original file, the file needs a block tree`)
+	DecryptFileCmd.Flags().Int64("length", -1, `decrypt only this number of bytes, to the end of the file if negative`)
+	DecryptFileCmd.Flags().Bool("restore-metadata", false, `set the mode and modification time stored by encryptFile, in a directory [targetFilePath] the file gets its original name`)
+}
+
+// flags of the commands decrypting files
+func addDecryptFlags(cmd *cobra.Command) {
+	cmd.Flags().String("workers", "1", `number of blocks decrypted in parallel, 0 for the number of cores`)
+	addProgressFlag(cmd)
+	cmd.Flags().Bool("allow-unauthenticated", false, `decrypt the files without MAC written by the previous versions, a modification can't be detected`)
+}
+
+func decryptOptions(cmd *cobra.Command) (*rsa.DecryptOptions, error) {
+	workers, err := workersFlag(cmd)
+	if err != nil {
+		return nil, err
+	}
+	options := &rsa.DecryptOptions{Workers: workers}
+	if options.Progress, err = progressFlag(cmd); err != nil {
+		return nil, err
+	}
+	options.AllowUnauthenticated, _ = cmd.Flags().GetBool("allow-unauthenticated")
+	return options, nil
 }
 
 func (m *cipherCLI) decryptFile(cmd *cobra.Command, args []string) error {
 	if len(args) < 3 {
 		return fmt.Errorf("usage cipher decryptFile [sourcefilePath] [targetFilePath] [privateKeyFilePath]")
 	}
+	options, err := decryptOptions(cmd)
+	if err != nil {
+		return err
+	}
+	options.RestoreMetadata, _ = cmd.Flags().GetBool("restore-metadata")
+	if options.RestoreMetadata && (args[0] == stdio || args[1] == stdio) {
+		return fmt.Errorf("option --restore-metadata needs a source and a target file")
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
 	t0 := time.Now()
-	if err := rsa.DecryptFile(args[0], args[1], args[2]); err != nil {
+	if cmd.Flags().Changed("offset") || cmd.Flags().Changed("length") {
+		err = decryptRange(ctx, cmd, args[0], args[1], args[2], options)
+	} else if args[0] == stdio || args[1] == stdio {
+		err = decryptStream(ctx, args[0], args[1], args[2], options)
+	} else {
+		err = rsa.DecryptFileContext(ctx, args[0], args[1], args[2], options)
+	}
+	if err != nil {
 		return err
 	}
-	fmt.Printf("done time=%ds\n", time.Now().Sub(t0).Nanoseconds()/1000000000)
+	status("done time=%ds\n", time.Now().Sub(t0).Nanoseconds()/1000000000)
 	return nil
 }
+
+// decrypts with the standard input or output for "-". The data written on the standard output before an error
+// are not authenticated, a target file is removed on error
+func decryptStream(ctx context.Context, sourcePath string, targetPath string, keyPath string, options *rsa.DecryptOptions) error {
+	source, err := openInput(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := createOutput(targetPath)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	err = rsa.DecryptStreamContext(ctx, source, target, keyPath, options)
+	if errc := target.Close(); err == nil {
+		err = errc
+	}
+	if err != nil && targetPath != stdio {
+		os.Remove(targetPath)
+	}
+	return err
+}
+
+// decrypts the range of the --offset and --length options, the source is read at random and can't be the
+// standard input
+func decryptRange(ctx context.Context, cmd *cobra.Command, sourcePath string, targetPath string, keyPath string, options *rsa.DecryptOptions) error {
+	offset, _ := cmd.Flags().GetInt64("offset")
+	length, _ := cmd.Flags().GetInt64("length")
+	if sourcePath == stdio {
+		return fmt.Errorf("options --offset and --length need a source file, not the standard input")
+	}
+	if targetPath != stdio {
+		return rsa.DecryptRangeContext(ctx, sourcePath, targetPath, keyPath, offset, length, options)
+	}
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	return rsa.DecryptRangeStream(ctx, source, os.Stdout, keyPath, offset, length, options)
+}
@@ -1,35 +1,163 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"github.com/freignat91/cipher/rsa"
 	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path/filepath"
 	"time"
 )
 
 var EncryptFileCmd = &cobra.Command{
-	Use:   "encryptFile [sourcefilePath] [targetFilePath] [publicKeyFilePath]",
+	Use:   "encryptFile [sourcefilePath] [targetFilePath] [publicKeyFilePath] --recipient [publicKeyFilePath] ...",
 	Short: "encrypt file",
-	Long:  `encrypt file`,
+	Long:  `encrypt file, "-" as source or target is the standard input or output`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := cipherCli.encryptFile(cmd, args); err != nil {
-			fmt.Printf("Error: %v\n", err)
+			commandError(err)
 		}
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(EncryptFileCmd)
+	addEncryptFlags(EncryptFileCmd)
+	EncryptFileCmd.Flags().Bool("metadata", true, `store the name, mode and modification time of the file in the encrypted data, restored by decryptFile --restore-metadata`)
+	EncryptFileCmd.Flags().String("verify", "", `private key: decrypt the encrypted file in memory after the encryption and compare it with the source`)
+	EncryptFileCmd.Flags().Bool("hide-name", false, `write the encrypted file in the directory [targetFilePath] under a random name, printed on the standard output`)
+}
+
+// flags of the commands encrypting files
+func addEncryptFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("recipient", nil, `public key of a recipient, can be repeated, selects the hybrid mode`)
+	cmd.Flags().String("workers", "1", `number of blocks encrypted in parallel, 0 for the number of cores`)
+	cmd.Flags().String("compress", "none", `compression before encryption: none, gzip, zstd or auto (gzip unless the file is already compressed), --compress alone is auto`)
+	cmd.Flags().Lookup("compress").NoOptDefVal = "auto"
+	cmd.Flags().Bool("armor", false, `ASCII armored output: base64 with BEGIN/END lines, can be pasted as text`)
+	addProgressFlag(cmd)
+	cmd.Flags().String("mode", "", `encryption mode: rsa (each block encrypted with the key), rsa-oaep (each block padded with RSA-OAEP, randomized) or hybrid (AES-256-GCM with a file key encrypted with the RSA key of each recipient, for large files), default rsa for a single key`)
+}
+
+func encryptOptions(cmd *cobra.Command) (*rsa.EncryptOptions, error) {
+	workers, err := workersFlag(cmd)
+	if err != nil {
+		return nil, err
+	}
+	options := &rsa.EncryptOptions{Mode: cmd.Flag("mode").Value.String(), Workers: workers}
+	if options.Progress, err = progressFlag(cmd); err != nil {
+		return nil, err
+	}
+	options.Recipients, _ = cmd.Flags().GetStringArray("recipient")
+	options.Compression = cmd.Flag("compress").Value.String()
+	options.Armor, _ = cmd.Flags().GetBool("armor")
+	return options, nil
 }
 
 func (m *cipherCLI) encryptFile(cmd *cobra.Command, args []string) error {
-	if len(args) < 3 {
+	recipients, _ := cmd.Flags().GetStringArray("recipient")
+	if len(args) < 3 && (len(args) < 2 || len(recipients) == 0) {
 		return fmt.Errorf("usage cipher encryptFile [sourcefilePath] [targetFilePath] [publicKeyFilePath]")
 	}
+	keyPath := ""
+	if len(args) > 2 {
+		keyPath = args[2]
+	}
+	options, err := encryptOptions(cmd)
+	if err != nil {
+		return err
+	}
+	options.Metadata, _ = cmd.Flags().GetBool("metadata")
+	targetPath := args[1]
+	if hideName, _ := cmd.Flags().GetBool("hide-name"); hideName {
+		if targetPath, err = hiddenTarget(targetPath); err != nil {
+			return err
+		}
+	}
+	verifyKey := cmd.Flag("verify").Value.String()
+	if verifyKey != "" && (args[0] == stdio || targetPath == stdio) {
+		return fmt.Errorf("option --verify needs a source and a target file")
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
 	t0 := time.Now()
-	if err := rsa.EncryptFile(args[0], args[1], args[2]); err != nil {
+	if args[0] == stdio || targetPath == stdio {
+		err = encryptStream(ctx, args[0], targetPath, keyPath, options)
+	} else {
+		err = rsa.EncryptFileContext(ctx, args[0], targetPath, keyPath, options)
+	}
+	if err != nil {
 		return err
 	}
-	fmt.Printf("done time=%ds\n", time.Now().Sub(t0).Nanoseconds()/1000000000)
+	if targetPath != args[1] {
+		fmt.Println(targetPath)
+	}
+	if verifyKey != "" {
+		if err := verifyRoundTrip(ctx, args[0], targetPath, verifyKey, options.Workers); err != nil {
+			return err
+		}
+		status("verified\n")
+	}
+	status("done time=%ds\n", time.Now().Sub(t0).Nanoseconds()/1000000000)
+	return nil
+}
+
+// encrypts with the standard input or output for "-", the original size is unknown when reading a pipe
+func encryptStream(ctx context.Context, sourcePath string, targetPath string, keyPath string, options *rsa.EncryptOptions) error {
+	source, err := openInput(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := createOutput(targetPath)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	if err := rsa.EncryptStreamContext(ctx, source, target, keyPath, options); err != nil {
+		return err
+	}
+	return target.Close()
+}
+
+// returns a random file path in the directory dir, the name of the source file is not leaked
+func hiddenTarget(dir string) (string, error) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("with --hide-name the target should be a directory: %s", dir)
+	}
+	name, err := rsa.RandomFileName()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// decrypts the encrypted file in memory and compares its hash with the hash of the source file
+func verifyRoundTrip(ctx context.Context, sourcePath string, encryptedPath string, keyPath string, workers int) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	expected := sha256.New()
+	if _, err := io.Copy(expected, source); err != nil {
+		return err
+	}
+	encrypted, err := os.Open(encryptedPath)
+	if err != nil {
+		return err
+	}
+	defer encrypted.Close()
+	decrypted := sha256.New()
+	if err := rsa.DecryptStreamContext(ctx, encrypted, decrypted, keyPath, &rsa.DecryptOptions{Workers: workers}); err != nil {
+		return fmt.Errorf("verification of %s failed: %v", encryptedPath, err)
+	}
+	if !bytes.Equal(expected.Sum(nil), decrypted.Sum(nil)) {
+		return fmt.Errorf("verification of %s failed: the decrypted data differ from %s", encryptedPath, sourcePath)
+	}
 	return nil
 }
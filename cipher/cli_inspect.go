@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var InspectCmd = &cobra.Command{
+	Use:   "inspect [filePath]",
+	Short: "display what can be learned from an encrypted file without the key",
+	Long:  `display the format version, mode, block size, number of blocks, recipient fingerprints and sizes of an encrypted file, and the inconsistencies found, nothing is decrypted`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.inspect(cmd, args); err != nil {
+			commandError(err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(InspectCmd)
+}
+
+func (m *cipherCLI) inspect(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage cipher inspect [filePath]")
+	}
+	info, err := rsa.InspectFile(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("format version: %d\n", info.Version)
+	fmt.Printf("armored:        %t\n", info.Armored)
+	fmt.Printf("mode:           %s\n", info.Mode)
+	if info.Content != "" {
+		fmt.Printf("content:        %s\n", info.Content)
+	}
+	if info.Compression != "" {
+		fmt.Printf("compression:    %s\n", info.Compression)
+	}
+	if info.Mode == rsa.ModeHybrid {
+		fmt.Printf("cipher:         %s\n", info.Cipher)
+		fmt.Printf("chunk size:     %d\n", info.BlockSize)
+		fmt.Printf("chunks:         %d\n", info.Blocks)
+	} else if info.BlockSize > 0 {
+		fmt.Printf("block size:     %d (%d bits key)\n", info.BlockSize, info.BlockSize*8)
+		fmt.Printf("blocks:         %d\n", info.Blocks)
+	}
+	if info.Version > 0 {
+		mac := info.MAC
+		if info.Mode == rsa.ModeHybrid {
+			mac = info.Cipher
+		} else if mac == "" {
+			mac = "none"
+		}
+		fmt.Printf("authentication: %s\n", mac)
+	}
+	if info.Tree != "" {
+		fmt.Printf("block tree:     %s\n", info.Tree)
+	}
+	if info.Length >= 0 {
+		fmt.Printf("original size:  %d\n", info.Length)
+	} else {
+		fmt.Printf("original size:  unknown\n")
+	}
+	fmt.Printf("encrypted size: %d\n", info.Size)
+	for _, fingerprint := range info.Fingerprints {
+		fmt.Printf("recipient:      %s\n", fingerprint)
+	}
+	for _, problem := range info.Problems {
+		fmt.Printf("problem:        %s\n", problem)
+	}
+	return nil
+}
+
+// verify with two arguments: decrypts and authenticates an encrypted file in memory
+func (m *cipherCLI) verifyFile(cmd *cobra.Command, args []string) error {
+	options, err := decryptOptions(cmd)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	t0 := time.Now()
+	blocks, err := rsa.VerifyEncryptedFileContext(ctx, args[0], args[1], options)
+	if verifyErr, ok := err.(*rsa.VerifyError); ok {
+		if verifyErr.Block >= 0 {
+			return fmt.Errorf("first bad %v", verifyErr)
+		}
+		if verifyErr.Err == rsa.ErrAuthentication {
+			return fmt.Errorf("%v, the bad block can't be located without block tree", verifyErr.Err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	status("ok blocks=%d time=%ds\n", blocks, time.Now().Sub(t0).Nanoseconds()/1000000000)
+	return nil
+}
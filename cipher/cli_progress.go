@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressAuto = "auto"
+	progressBar  = "bar"
+	progressJSON = "json"
+	progressNone = "none"
+	//minimum time between two bar updates and two json lines
+	progressBarPeriod  = 200 * time.Millisecond
+	progressJSONPeriod = time.Second
+	progressBarWidth   = 30
+)
+
+// progressReport shows the progress of the command on stderr, a bar with the ETA or json lines
+type progressReport struct {
+	format string
+	mutex  sync.Mutex
+	last   time.Time
+	//last progress received and if it has been shown
+	current rsa.Progress
+	shown   bool
+	//a bar is on the current line
+	bar bool
+}
+
+// json line of --progress=json, the times are in seconds, eta is -1 if unknown
+type progressLine struct {
+	Bytes      int64   `json:"bytes"`
+	Total      int64   `json:"total"`
+	Blocks     int64   `json:"blocks"`
+	Elapsed    float64 `json:"elapsed"`
+	Throughput float64 `json:"throughput"`
+	ETA        float64 `json:"eta"`
+	Done       bool    `json:"done,omitempty"`
+}
+
+// flag of the commands encrypting or decrypting files
+func addProgressFlag(cmd *cobra.Command) {
+	cmd.Flags().String("progress", progressAuto, `progress on stderr: bar (with the ETA), json (a line per second), none, auto is a bar if stderr is a terminal`)
+}
+
+// returns the callback of the --progress option, nil without progress. The report is ended by status
+func progressFlag(cmd *cobra.Command) (func(rsa.Progress), error) {
+	format := cmd.Flag("progress").Value.String()
+	switch format {
+	case progressAuto:
+		if !isTerminal(os.Stderr) {
+			return nil, nil
+		}
+		format = progressBar
+	case progressNone:
+		return nil, nil
+	case progressBar, progressJSON:
+	default:
+		return nil, fmt.Errorf("option --progress should be %s, %s, %s or %s", progressAuto, progressBar, progressJSON, progressNone)
+	}
+	cipherCli.progress = &progressReport{format: format}
+	return cipherCli.progress.update, nil
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (r *progressReport) update(progress rsa.Progress) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.current, r.shown = progress, false
+	period := progressBarPeriod
+	if r.format == progressJSON {
+		period = progressJSONPeriod
+	}
+	if time.Since(r.last) >= period {
+		r.show(false)
+	}
+}
+
+func (r *progressReport) show(done bool) {
+	r.last, r.shown = time.Now(), true
+	p := r.current
+	if r.format == progressJSON {
+		line := progressLine{Bytes: p.Bytes, Total: p.Total, Blocks: p.Blocks, Elapsed: p.Elapsed.Seconds(), Throughput: p.Throughput(), ETA: -1, Done: done}
+		if eta := p.ETA(); eta >= 0 {
+			line.ETA = eta.Seconds()
+		}
+		data, _ := json.Marshal(&line)
+		fmt.Fprintf(os.Stderr, "%s\n", data)
+		return
+	}
+	r.bar = true
+	if p.Total <= 0 {
+		fmt.Fprintf(os.Stderr, "\r%s  %s/s  blocks=%d ", formatSize(p.Bytes), formatSize(int64(p.Throughput())), p.Blocks)
+		return
+	}
+	filled := int(int64(progressBarWidth) * p.Bytes / p.Total)
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	eta := "?"
+	if d := p.ETA(); d >= 0 {
+		eta = d.Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %3d%%  %s/%s  %s/s  ETA %s ", strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled),
+		100*p.Bytes/p.Total, formatSize(p.Bytes), formatSize(p.Total), formatSize(int64(p.Throughput())), eta)
+}
+
+// shows the last progress and ends the bar line, the report can be used again for the next file
+func (r *progressReport) end() {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.current.Blocks > 0 && (!r.shown || r.format == progressJSON) {
+		r.show(true)
+	}
+	if r.bar {
+		fmt.Fprintf(os.Stderr, "\n")
+	}
+	r.current, r.shown, r.bar, r.last = rsa.Progress{}, false, false, time.Time{}
+}
+
+func formatSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size, unit := float64(n), 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", n, units[0])
+	}
+	return fmt.Sprintf("%.1f%s", size, units[unit])
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var AddRecipientCmd = &cobra.Command{
+	Use:   "addRecipient [filePath] [privateKeyFilePath] [publicKeyFilePath] ...",
+	Short: "add recipients to a hybrid encrypted file",
+	Long:  `add recipients to a hybrid encrypted file, the private key of a recipient decrypts the file key which is encrypted for the new public keys, the content is not encrypted again`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.addRecipient(cmd, args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var RemoveRecipientCmd = &cobra.Command{
+	Use:   "removeRecipient [filePath] [publicKeyFilePath or fingerprint] ...",
+	Short: "remove recipients from a hybrid encrypted file",
+	Long:  `remove recipients from a hybrid encrypted file, a removed recipient who kept a copy of the file or of its key can still decrypt it`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.removeRecipient(cmd, args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(AddRecipientCmd)
+	RootCmd.AddCommand(RemoveRecipientCmd)
+}
+
+func (m *cipherCLI) addRecipient(cmd *cobra.Command, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage cipher addRecipient [filePath] [privateKeyFilePath] [publicKeyFilePath] ...")
+	}
+	return rsa.AddRecipients(args[0], args[1], args[2:]...)
+}
+
+func (m *cipherCLI) removeRecipient(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage cipher removeRecipient [filePath] [publicKeyFilePath or fingerprint] ...")
+	}
+	return rsa.RemoveRecipients(args[0], args[1:]...)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+var RekeyCmd = &cobra.Command{
+	Use:   "rekey [filePath or dirPath] --from [privateKeyFilePath] --to [publicKeyFilePath]",
+	Short: "encrypt files for a new key without writing the plaintext",
+	Long:  `encrypt a file, or the files of a directory tree encrypted for the old key, for a new key: only the header is rewritten in hybrid mode, the other modes are decrypted into the new encryption in memory. Each file is replaced atomically`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.rekey(cmd, args); err != nil {
+			commandError(err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(RekeyCmd)
+	addDecryptFlags(RekeyCmd)
+	RekeyCmd.Flags().String("from", "", `private key the files are encrypted for`)
+	RekeyCmd.Flags().String("to", "", `public key the files are encrypted for after the command`)
+	RekeyCmd.Flags().Bool("dry-run", false, `list the files still encrypted for the old key without changing them`)
+}
+
+func (m *cipherCLI) rekey(cmd *cobra.Command, args []string) error {
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	if len(args) < 1 || from == "" || (to == "" && !dryRun) {
+		return fmt.Errorf("usage cipher rekey [filePath or dirPath] --from [privateKeyFilePath] --to [publicKeyFilePath]")
+	}
+	options, err := decryptOptions(cmd)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(args[0])
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	t0 := time.Now()
+	//a file given alone is rekeyed even if its header doesn't tell its key, as the files of the previous versions
+	if !info.IsDir() && !dryRun {
+		if err := rsa.RekeyFileContext(ctx, args[0], from, to, options); err != nil {
+			return err
+		}
+		status("done time=%ds\n", time.Now().Sub(t0).Nanoseconds()/1000000000)
+		return nil
+	}
+	files, err := rsa.FilesOnKey(args[0], from)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		unreadable := 0
+		for _, file := range files {
+			if file.Err != nil {
+				status("%s: %v\n", file.Path, file.Err)
+				unreadable++
+				continue
+			}
+			fmt.Printf("%-8s %s\n", file.Mode, file.Path)
+		}
+		status("%d files on the old key, %d files not read\n", len(files)-unreadable, unreadable)
+		return nil
+	}
+	failed := 0
+	for _, file := range files {
+		if file.Err != nil {
+			status("%s: %v\n", file.Path, file.Err)
+			failed++
+			continue
+		}
+		if err := rsa.RekeyFileContext(ctx, file.Path, from, to, options); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			status("%s: %v\n", file.Path, err)
+			failed++
+			continue
+		}
+		status("%s rekeyed\n", file.Path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files not rekeyed", failed, len(files))
+	}
+	status("done files=%d time=%ds\n", len(files), time.Now().Sub(t0).Nanoseconds()/1000000000)
+	return nil
+}
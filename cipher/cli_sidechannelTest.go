@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+)
+
+var SideChannelTestCmd = &cobra.Command{
+	Use:   "sidechannel-test",
+	Short: "Timing side channel test of decryption, exponentiation and padding checks",
+	Long:  `Timing side channel test (dudect): measure decryption, exponentiation and padding checks on a fixed input and random inputs and report the Welch t-test statistic, |t| > 10 means the time depends on the input`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.sideChannelTest(cmd, args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(SideChannelTestCmd)
+	SideChannelTestCmd.Flags().String("size", "1024", `RSA Key size (bit)`)
+	SideChannelTestCmd.Flags().String("samples", "10000", `number of measures of each operation`)
+}
+
+func (m *cipherCLI) sideChannelTest(cmd *cobra.Command, args []string) error {
+	keyBitSize, err := strconv.Atoi(cmd.Flag("size").Value.String())
+	if err != nil {
+		return fmt.Errorf("option --size is not a number")
+	}
+	samples, err := strconv.Atoi(cmd.Flag("samples").Value.String())
+	if err != nil {
+		return fmt.Errorf("option --samples is not a number")
+	}
+	results, err := rsa.RunTimingTests(keyBitSize, samples, m.verbose)
+	if err != nil {
+		return err
+	}
+	failed := false
+	fmt.Printf("%-28s %10s %12s %12s  %s\n", "operation", "|t|", "fixed", "random", "result")
+	for _, result := range results {
+		status := "ok"
+		if result.Leaky() {
+			status = "LEAKY"
+			if result.ConstantTime {
+				status = "LEAKY, should be constant time"
+				failed = true
+			} else {
+				status = "LEAKY, expected"
+			}
+		}
+		fmt.Printf("%-28s %10.2f %12v %12v  %s\n", result.Name, result.T, result.FixedMean, result.RandomMean, status)
+	}
+	if failed {
+		return fmt.Errorf("timing leak found in constant time code")
+	}
+	return nil
+}
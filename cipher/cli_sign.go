@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var SignCmd = &cobra.Command{
+	Use:   "sign [filePath] [privateKeyFilePath]",
+	Short: "sign file",
+	Long:  `sign file, the detached signature is saved in [filePath].sig or in the file set by --output`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.sign(cmd, args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(SignCmd)
+	SignCmd.Flags().String("output", "", `signature file path, default [filePath].sig`)
+	SignCmd.Flags().String("scheme", rsa.SchemePSS, `signature scheme: pss or pkcs1v15`)
+	SignCmd.Flags().String("hash", "sha256", `hash function: sha256, sha384 or sha512`)
+}
+
+func (m *cipherCLI) sign(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage cipher sign [filePath] [privateKeyFilePath]")
+	}
+	hash, err := rsa.GetHash(cmd.Flag("hash").Value.String())
+	if err != nil {
+		return err
+	}
+	sigPath := cmd.Flag("output").Value.String()
+	if sigPath == "" {
+		sigPath = args[0] + ".sig"
+	}
+	if err := rsa.SignFile(args[0], sigPath, args[1], cmd.Flag("scheme").Value.String(), hash); err != nil {
+		return err
+	}
+	if m.verbose {
+		fmt.Printf("signature saved in %s\n", sigPath)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"github.com/spf13/cobra"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var EncryptCmd = &cobra.Command{
+	Use:   "encrypt [publicKeyFilePath] --text [text]",
+	Short: "encrypt a text",
+	Long:  `encrypt a short text and print it as an armored message which can be pasted in a chat, a ticket or a yaml file. Without --text the text is read on the standard input`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.encryptText(cmd, args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var DecryptCmd = &cobra.Command{
+	Use:   "decrypt [privateKeyFilePath] --text",
+	Short: "decrypt a text",
+	Long:  `decrypt an armored message read on the standard input and print the text`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.decryptText(cmd, args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(EncryptCmd)
+	RootCmd.AddCommand(DecryptCmd)
+	EncryptCmd.Flags().String("text", "", `text to encrypt`)
+	EncryptCmd.Flags().StringArray("recipient", nil, `public key of a recipient, can be repeated, selects the hybrid mode`)
+	EncryptCmd.Flags().String("mode", rsa.ModeOAEP, `encryption mode: rsa-oaep (randomized, the same text gives different messages), rsa or hybrid`)
+	DecryptCmd.Flags().Bool("text", false, `decrypt an armored text message`)
+}
+
+func (m *cipherCLI) encryptText(cmd *cobra.Command, args []string) error {
+	recipients, _ := cmd.Flags().GetStringArray("recipient")
+	keyPaths := append(args, recipients...)
+	if len(keyPaths) == 0 {
+		return fmt.Errorf("usage cipher encrypt [publicKeyFilePath] --text [text]")
+	}
+	mode := cmd.Flag("mode").Value.String()
+	if len(keyPaths) > 1 && !cmd.Flags().Changed("mode") {
+		mode = rsa.ModeHybrid
+	}
+	publicKeys := []*rsa.PublicKey{}
+	for _, path := range keyPaths {
+		publicKey, err := rsa.GetPublicKey(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	var text io.Reader = os.Stdin
+	if cmd.Flags().Changed("text") {
+		text = strings.NewReader(cmd.Flag("text").Value.String())
+	}
+	w, err := rsa.NewEncryptWriterWithOptions(os.Stdout, publicKeys, &rsa.EncryptOptions{Mode: mode, Armor: true})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, text); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (m *cipherCLI) decryptText(cmd *cobra.Command, args []string) error {
+	if text, _ := cmd.Flags().GetBool("text"); !text || len(args) < 1 {
+		return fmt.Errorf("usage cipher decrypt [privateKeyFilePath] --text, use decryptFile for files")
+	}
+	privateKey, err := rsa.GetPrivateKey(args[0])
+	if err != nil {
+		return err
+	}
+	r, err := rsa.NewDecryptReader(os.Stdin, privateKey)
+	if err != nil {
+		return err
+	}
+	//the text is printed only once authenticated
+	text, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(text)
+	return err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var VerifyCmd = &cobra.Command{
+	Use:   "verify [filePath] [privateKeyFilePath] | [filePath] [signatureFilePath] [publicKeyFilePath]",
+	Short: "verify an encrypted file or a file signature",
+	Long:  `with two arguments, decrypt and authenticate an encrypted file in memory, nothing is written, the first bad block is reported. With three arguments, verify the detached signature of a file`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cipherCli.verify(cmd, args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(VerifyCmd)
+	VerifyCmd.Flags().String("scheme", rsa.SchemePSS, `signature scheme: pss or pkcs1v15`)
+	VerifyCmd.Flags().String("hash", "sha256", `hash function: sha256, sha384 or sha512`)
+	addDecryptFlags(VerifyCmd)
+}
+
+func (m *cipherCLI) verify(cmd *cobra.Command, args []string) error {
+	if len(args) == 2 {
+		return m.verifyFile(cmd, args)
+	}
+	if len(args) < 3 {
+		return fmt.Errorf("usage cipher verify [filePath] [privateKeyFilePath] or cipher verify [filePath] [signatureFilePath] [publicKeyFilePath]")
+	}
+	hash, err := rsa.GetHash(cmd.Flag("hash").Value.String())
+	if err != nil {
+		return err
+	}
+	if err := rsa.VerifyFile(args[0], args[1], args[2], cmd.Flag("scheme").Value.String(), hash); err != nil {
+		return err
+	}
+	fmt.Println("signature ok")
+	return nil
+}
@@ -0,0 +1,381 @@
+package rsa
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directory archives: the data encrypted are the index of the entries, its length on 4 bytes big endian then
+// json, followed by the content of the files in the order of the index. The index comes first so that the
+// archive can be listed decrypting only the beginning of the file
+const (
+	contentArchive = "archive"
+	//sanity limit on the index size
+	maxIndexSize = 64 << 20
+)
+
+const (
+	EntryFile    = "file"
+	EntryDir     = "dir"
+	EntrySymlink = "symlink"
+)
+
+type ArchiveEntry struct {
+	//path relative to the archived directory with / separators, "." for the directory itself
+	Path string `json:"path"`
+	Type string `json:"type"`
+	//permission bits
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+	//size of a file, target of a symbolic link
+	Size   int64  `json:"size,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+type archiveIndex struct {
+	Entries []ArchiveEntry `json:"entries"`
+}
+
+func EncryptDir(sourceDir string, targetPath string, keyPath string, options *EncryptOptions) error {
+	return EncryptDirContext(context.Background(), sourceDir, targetPath, keyPath, options)
+}
+
+// EncryptDirContext encrypts the files, directories and symbolic links of sourceDir in a single archive, the
+// symbolic links are not followed and the other kinds of files (devices, sockets, pipes) are skipped
+func EncryptDirContext(ctx context.Context, sourceDir string, targetPath string, keyPath string, options *EncryptOptions) error {
+	options, publicKeys, err := encryptionKeys(keyPath, options)
+	if err != nil {
+		return err
+	}
+	//a symbolic link given as directory is followed
+	if sourceDir, err = filepath.EvalSymlinks(sourceDir); err != nil {
+		return err
+	}
+	//the archive is not archived if it is written in the directory
+	skip, err := filepath.Abs(targetPath)
+	if err != nil {
+		return err
+	}
+	entries, err := archiveEntries(sourceDir, skip)
+	if err != nil {
+		return err
+	}
+	index, err := json.Marshal(&archiveIndex{Entries: entries})
+	if err != nil {
+		return err
+	}
+	if len(index) > maxIndexSize {
+		return fmt.Errorf("too many files in %s", sourceDir)
+	}
+	length := int64(4 + len(index))
+	for _, entry := range entries {
+		length += entry.Size
+	}
+	fileo, errf := os.Create(targetPath)
+	if errf != nil {
+		return errf
+	}
+	defer fileo.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w, err := newEncryptWriter(ctx, fileo, publicKeys, options, fileHeader{Length: length, Content: contentArchive})
+	if err != nil {
+		return err
+	}
+	if err := writeArchive(w, sourceDir, index, entries); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return fileo.Close()
+}
+
+func archiveEntries(dir string, skip string) ([]ArchiveEntry, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	entries := []ArchiveEntry{}
+	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if abs, _ := filepath.Abs(file); abs == skip {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		entry := ArchiveEntry{Path: filepath.ToSlash(rel), Mode: info.Mode().Perm(), ModTime: info.ModTime()}
+		switch {
+		case info.Mode().IsRegular():
+			entry.Type, entry.Size = EntryFile, info.Size()
+		case info.IsDir():
+			entry.Type = EntryDir
+		case info.Mode()&os.ModeSymlink != 0:
+			if entry.Target, err = os.Readlink(file); err != nil {
+				return err
+			}
+			entry.Type = EntrySymlink
+		default:
+			return nil
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+func writeArchive(w io.Writer, dir string, index []byte, entries []ArchiveEntry) error {
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(index)))
+	if _, err := w.Write(size); err != nil {
+		return err
+	}
+	if _, err := w.Write(index); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Type == EntryFile {
+			if err := copyArchiveFile(w, filepath.Join(dir, filepath.FromSlash(entry.Path)), entry.Size); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func copyArchiveFile(w io.Writer, file string, size int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.CopyN(w, f, size); err == io.EOF {
+		return fmt.Errorf("%s: file truncated during the encryption", file)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func DecryptDir(sourcePath string, targetDir string, keyPath string, options *DecryptOptions) error {
+	return DecryptDirContext(context.Background(), sourcePath, targetDir, keyPath, options)
+}
+
+// DecryptDirContext extracts the archive in targetDir, which must not exist. The paths of the index are checked
+// before anything is written: absolute paths, paths going out of targetDir and paths through a symbolic link of
+// the archive are refused, and the symbolic links are created last. The archive is extracted in a temporary
+// directory renamed to targetDir once the whole archive is authenticated
+func DecryptDirContext(ctx context.Context, sourcePath string, targetDir string, keyPath string, options *DecryptOptions) error {
+	if _, err := os.Lstat(targetDir); err == nil {
+		return fmt.Errorf("%s already exists", targetDir)
+	}
+	privateKey, errp := GetPrivateKey(keyPath)
+	if errp != nil {
+		return errp
+	}
+	filei, errf := os.Open(sourcePath)
+	if errf != nil {
+		return errf
+	}
+	defer filei.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r, entries, err := openArchive(ctx, filei, privateKey, options)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(targetDir), filepath.Base(targetDir)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := extractArchive(r, tmp, entries); err != nil {
+		return err
+	}
+	//the end of the data authenticates the archive
+	if extra, err := io.Copy(ioutil.Discard, r); err != nil {
+		return err
+	} else if extra > 0 {
+		return fmt.Errorf("corrupted archive: %d bytes after the last file", extra)
+	}
+	if err := setDirAttributes(tmp, entries); err != nil {
+		return err
+	}
+	return os.Rename(tmp, targetDir)
+}
+
+// ListArchive returns the entries of the archive decrypting only its index, which is not authenticated
+// in rsa and rsa-oaep modes: the MAC is at the end of the file
+func ListArchive(sourcePath string, keyPath string, options *DecryptOptions) ([]ArchiveEntry, error) {
+	privateKey, err := GetPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	filei, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	defer filei.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, entries, err := openArchive(ctx, filei, privateKey, options)
+	return entries, err
+}
+
+// returns the reader of the archive positioned after the index and the entries of the index, checked
+func openArchive(ctx context.Context, r io.Reader, privateKey *PrivateKey, options *DecryptOptions) (io.Reader, []ArchiveEntry, error) {
+	reader, header, err := newDecryptReader(ctx, r, privateKey, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Content != contentArchive {
+		return nil, nil, fmt.Errorf("the file is not a directory archive, use decryptFile")
+	}
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(reader, size); err != nil {
+		return nil, nil, fmt.Errorf("can't read the archive index: %v", err)
+	}
+	if binary.BigEndian.Uint32(size) > maxIndexSize {
+		return nil, nil, fmt.Errorf("corrupted archive: invalid index size")
+	}
+	data := make([]byte, binary.BigEndian.Uint32(size))
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, nil, fmt.Errorf("can't read the archive index: %v", err)
+	}
+	index := &archiveIndex{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, nil, fmt.Errorf("corrupted archive index: %v", err)
+	}
+	if err := checkEntries(index.Entries); err != nil {
+		return nil, nil, err
+	}
+	return reader, index.Entries, nil
+}
+
+// refuses the entries which would be written out of the extraction directory
+func checkEntries(entries []ArchiveEntry) error {
+	paths := map[string]bool{}
+	symlinks := map[string]bool{}
+	for _, entry := range entries {
+		switch entry.Type {
+		case EntryFile, EntryDir, EntrySymlink:
+		default:
+			return fmt.Errorf("unknown archive entry type %s for %s", entry.Type, entry.Path)
+		}
+		if !safePath(entry.Path) && !(entry.Path == "." && entry.Type == EntryDir) {
+			return fmt.Errorf("unsafe path in the archive: %q", entry.Path)
+		}
+		if entry.Size < 0 || entry.Size > 0 && entry.Type != EntryFile {
+			return fmt.Errorf("invalid size for %s", entry.Path)
+		}
+		if paths[entry.Path] {
+			return fmt.Errorf("duplicate path in the archive: %s", entry.Path)
+		}
+		paths[entry.Path] = true
+		if entry.Type == EntrySymlink {
+			symlinks[entry.Path] = true
+		}
+	}
+	for _, entry := range entries {
+		for dir := path.Dir(entry.Path); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if symlinks[dir] {
+				return fmt.Errorf("unsafe path in the archive: %s is under the symbolic link %s", entry.Path, dir)
+			}
+		}
+	}
+	return nil
+}
+
+// relative path staying under the directory
+func safePath(p string) bool {
+	return p != "" && path.Clean(p) == p && !path.IsAbs(p) && p != "." && p != ".." && !strings.HasPrefix(p, "../") && !strings.Contains(p, "\\")
+}
+
+func extractArchive(r io.Reader, dir string, entries []ArchiveEntry) error {
+	for _, entry := range entries {
+		target := filepath.Join(dir, filepath.FromSlash(entry.Path))
+		switch entry.Type {
+		case EntryDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+		case EntryFile:
+			if err := extractFile(r, target, entry); err != nil {
+				return err
+			}
+		}
+	}
+	//symbolic links last, no file is written through them
+	for _, entry := range entries {
+		if entry.Type != EntrySymlink {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(entry.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return err
+		}
+		if err := os.Symlink(entry.Target, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractFile(r io.Reader, target string, entry ArchiveEntry) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.CopyN(f, r, entry.Size); err == io.EOF {
+		return fmt.Errorf("corrupted archive: %s truncated", entry.Path)
+	} else if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(target, entry.Mode.Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(target, entry.ModTime, entry.ModTime)
+}
+
+// modes and times of the directories, set last: writing the files changes them. Children come after their parent
+// in the index, it is read backwards
+func setDirAttributes(dir string, entries []ArchiveEntry) error {
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Type != EntryDir {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(entry.Path))
+		if err := os.Chmod(target, entry.Mode.Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, entry.ModTime, entry.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
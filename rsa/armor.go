@@ -0,0 +1,232 @@
+package rsa
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ASCII armor of the encrypted data, as in OpenPGP (RFC 4880 section 6):
+//
+//	-----BEGIN CIPHER MESSAGE-----
+//	Key: value
+//
+//	base64 lines of 64 characters
+//	=checksum, CRC24 of the data in base64
+//	-----END CIPHER MESSAGE-----
+//
+// The headers are informative, they are not authenticated
+const (
+	armorBegin      = "-----BEGIN CIPHER MESSAGE-----"
+	armorEnd        = "-----END CIPHER MESSAGE-----"
+	armorLineLength = 64
+	crc24Init       = 0xb704ce
+	crc24Poly       = 0x1864cfb
+)
+
+func crc24(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+type armorWriter struct {
+	w      io.Writer
+	lines  *lineWriter
+	base64 io.WriteCloser
+	crc    uint32
+}
+
+// NewArmorWriter returns a writer encoding the data written into w with ASCII armor, Close writes the checksum
+// and the END line, it doesn't close w
+func NewArmorWriter(w io.Writer, headers map[string]string) (io.WriteCloser, error) {
+	head := &bytes.Buffer{}
+	head.WriteString(armorBegin + "\n")
+	keys := []string{}
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.ContainsAny(key, ":\n") || strings.Contains(headers[key], "\n") {
+			return nil, fmt.Errorf("invalid armor header %q", key)
+		}
+		fmt.Fprintf(head, "%s: %s\n", key, headers[key])
+	}
+	head.WriteString("\n")
+	if _, err := w.Write(head.Bytes()); err != nil {
+		return nil, err
+	}
+	lines := &lineWriter{w: w}
+	return &armorWriter{w: w, lines: lines, base64: base64.NewEncoder(base64.StdEncoding, lines), crc: crc24Init}, nil
+}
+
+func (a *armorWriter) Write(p []byte) (int, error) {
+	a.crc = crc24(a.crc, p)
+	return a.base64.Write(p)
+}
+
+func (a *armorWriter) Close() error {
+	if err := a.base64.Close(); err != nil {
+		return err
+	}
+	end := ""
+	if a.lines.column > 0 {
+		end = "\n"
+	}
+	crc := []byte{byte(a.crc >> 16), byte(a.crc >> 8), byte(a.crc)}
+	_, err := fmt.Fprintf(a.w, "%s=%s\n%s\n", end, base64.StdEncoding.EncodeToString(crc), armorEnd)
+	return err
+}
+
+// cuts the base64 data in lines
+type lineWriter struct {
+	w      io.Writer
+	column int
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := armorLineLength - l.column
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := l.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		l.column += n
+		p = p[n:]
+		if l.column == armorLineLength {
+			if _, err := l.w.Write([]byte{'\n'}); err != nil {
+				return written, err
+			}
+			l.column = 0
+		}
+	}
+	return written, nil
+}
+
+// isArmored tells if r starts with the BEGIN line, blank characters before it are ignored
+func isArmored(r *bufio.Reader) bool {
+	start, _ := r.Peek(armorLineLength)
+	return bytes.HasPrefix(bytes.TrimLeft(start, " \t\r\n"), []byte(armorBegin))
+}
+
+type armorReader struct {
+	r *bufio.Reader
+	//base64 characters not decoded yet and data decoded not read yet
+	pending string
+	buf     []byte
+	crc     uint32
+	done    bool
+}
+
+// NewArmorReader reads the BEGIN line and the headers of the armored data in r and returns a reader decoding
+// the data. Read fails at the end if the checksum is wrong or the END line is missing
+func NewArmorReader(r io.Reader) (io.Reader, map[string]string, error) {
+	br := bufio.NewReader(r)
+	line, err := readArmorLine(br)
+	for err == nil && line == "" {
+		line, err = readArmorLine(br)
+	}
+	if err != nil || line != armorBegin {
+		return nil, nil, fmt.Errorf("not an armored cipher message")
+	}
+	headers := map[string]string{}
+	for {
+		line, err := readArmorLine(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid armor: %v", err)
+		}
+		if line == "" {
+			break
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, nil, fmt.Errorf("invalid armor header %q", line)
+		}
+		headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return &armorReader{r: br, crc: crc24Init}, headers, nil
+}
+
+// returns the next line without its end of line and the blank characters around it
+func readArmorLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimSpace(line), err
+}
+
+func (a *armorReader) Read(p []byte) (int, error) {
+	for len(a.buf) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+		if err := a.readLine(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, a.buf)
+	a.buf = a.buf[n:]
+	return n, nil
+}
+
+// decodes the next line, lines of any length are accepted
+func (a *armorReader) readLine() error {
+	line, err := readArmorLine(a.r)
+	if err == io.EOF {
+		return fmt.Errorf("invalid armor: %s missing", armorEnd)
+	}
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(line, "=") || line == armorEnd {
+		return a.end(line)
+	}
+	a.pending += line
+	n := len(a.pending) / 4 * 4
+	data, err := base64.StdEncoding.DecodeString(a.pending[:n])
+	if err != nil {
+		return fmt.Errorf("invalid armor: %v", err)
+	}
+	a.pending = a.pending[n:]
+	a.crc = crc24(a.crc, data)
+	a.buf = data
+	return nil
+}
+
+// checks the checksum, optional, and the END line
+func (a *armorReader) end(line string) error {
+	if a.pending != "" {
+		return fmt.Errorf("invalid armor: truncated base64 data")
+	}
+	if strings.HasPrefix(line, "=") {
+		crc, err := base64.StdEncoding.DecodeString(line[1:])
+		if err != nil || len(crc) != 3 {
+			return fmt.Errorf("invalid armor checksum %q", line)
+		}
+		if uint32(crc[0])<<16|uint32(crc[1])<<8|uint32(crc[2]) != a.crc {
+			return fmt.Errorf("armor checksum mismatch, the message has been altered")
+		}
+		if line, _ = readArmorLine(a.r); line != armorEnd {
+			return fmt.Errorf("invalid armor: %s missing", armorEnd)
+		}
+	}
+	a.done = true
+	return nil
+}
@@ -19,7 +19,43 @@ func NewDecimal(decimal string) *big.Int {
 	return nn
 }
 
+// exponentiation algorithms for public key operations
+type ExpAlgorithm int32
+
+const (
+	//default, the fastest by the PublicExp benchmark: math/big Exp below expWindowMinBits, the window above
+	ExpAuto ExpAlgorithm = iota
+	//sliding window, PowModuloWindow
+	ExpWindow
+	//square and multiply, PowModulo
+	ExpBinary
+	//math/big Exp
+	ExpBig
+)
+
+var expAlgorithmNames = []string{"auto", "window", "binary", "big"}
+
+// modulus size from which the sliding window is faster than math/big Exp
+const expWindowMinBits = 16384
+
+func ParseExpAlgorithm(name string) (ExpAlgorithm, error) {
+	for i, algorithmName := range expAlgorithmNames {
+		if name == algorithmName {
+			return ExpAlgorithm(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown exponentiation algorithm: %s, should be one of %v", name, expAlgorithmNames)
+}
+
+func (a ExpAlgorithm) String() string {
+	if a < 0 || int(a) >= len(expAlgorithmNames) {
+		return fmt.Sprintf("ExpAlgorithm(%d)", int32(a))
+	}
+	return expAlgorithmNames[a]
+}
+
 func PowModulo(b *big.Int, e *big.Int, m *big.Int) *big.Int {
+	b = big.NewInt(0).Set(b)
 	pp := big.NewInt(1)
 	for i, j := 0, e.BitLen(); i < j; i++ {
 		if e.Bit(i) != 0 {
@@ -247,3 +283,53 @@ func InverseModulo(b *big.Int, n *big.Int) *big.Int {
 	return t
 }
 */
+
+// PowModuloWindow returns b^e mod m with a sliding window exponentiation: about 1.2 multiplications
+// per bit of e instead of 1.5 for PowModulo. Its time depends on e, use it only for public exponents
+func PowModuloWindow(b *big.Int, e *big.Int, m *big.Int) *big.Int {
+	w := slidingWindowSize(e.BitLen())
+	//odd powers b, b^3, ..., b^(2^w-1)
+	table := make([]*big.Int, 1<<uint(w-1))
+	table[0] = big.NewInt(0).Mod(b, m)
+	b2 := big.NewInt(0).Mul(table[0], table[0])
+	b2.Mod(b2, m)
+	for i := 1; i < len(table); i++ {
+		table[i] = big.NewInt(0).Mul(table[i-1], b2)
+		table[i].Mod(table[i], m)
+	}
+	pp := big.NewInt(0).Mod(one, m)
+	for i := e.BitLen() - 1; i >= 0; {
+		if e.Bit(i) == 0 {
+			pp.Mod(pp.Mul(pp, pp), m)
+			i--
+			continue
+		}
+		//longest window of at most w bits ending with a 1
+		j := i - w + 1
+		if j < 0 {
+			j = 0
+		}
+		for e.Bit(j) == 0 {
+			j++
+		}
+		value := 0
+		for k := i; k >= j; k-- {
+			pp.Mod(pp.Mul(pp, pp), m)
+			value = value<<1 | int(e.Bit(k))
+		}
+		pp.Mod(pp.Mul(pp, table[value>>1]), m)
+		i = j - 1
+	}
+	return pp
+}
+
+// window size minimizing the number of multiplications for an exponent of ebits bits
+func slidingWindowSize(ebits int) int {
+	w := 1
+	for _, limit := range []int{24, 80, 240, 672} {
+		if ebits > limit {
+			w++
+		}
+	}
+	return w
+}
@@ -0,0 +1,205 @@
+package rsa
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+)
+
+// compression of the data before encryption, recorded in the file header
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	//faster than gzip for the same ratio, klauspost/compress codec
+	CompressionZstd = "zstd"
+	//gzip unless the data are already compressed
+	CompressionAuto = "auto"
+)
+
+// size of the sample used to detect already compressed data
+const compressionSample = 64 * 1024
+
+// start of already compressed formats: gzip, zip, bzip2, xz, zstd, 7z, rar, png, jpeg, gif and cipher files
+var compressedMagics = [][]byte{
+	{0x1f, 0x8b},
+	[]byte("PK\x03\x04"),
+	[]byte("BZh"),
+	[]byte("\xfd7zXZ\x00"),
+	{0x28, 0xb5, 0x2f, 0xfd},
+	[]byte("7z\xbc\xaf\x27\x1c"),
+	[]byte("Rar!\x1a\x07"),
+	[]byte("\x89PNG"),
+	{0xff, 0xd8, 0xff},
+	[]byte("GIF8"),
+	[]byte(fileMagic),
+}
+
+func checkCompression(compression string) error {
+	switch compression {
+	case "", CompressionNone, CompressionGzip, CompressionZstd, CompressionAuto:
+		return nil
+	}
+	return fmt.Errorf("unknown compression: %s, should be %s, %s, %s or %s", compression, CompressionNone, CompressionGzip, CompressionZstd, CompressionAuto)
+}
+
+// returns a writer compressing into w with the gzip or zstd compression
+func newCompressor(compression string, w io.Writer) (io.WriteCloser, error) {
+	if compression == CompressionZstd {
+		return zstd.NewWriter(w)
+	}
+	return gzip.NewWriter(w), nil
+}
+
+// chooses the compression of data starting with sample: none for known compressed formats and for
+// data gzip doesn't reduce by 5% at least
+func detectCompression(sample []byte) string {
+	if len(sample) == 0 {
+		return CompressionNone
+	}
+	for _, magic := range compressedMagics {
+		if bytes.HasPrefix(sample, magic) {
+			return CompressionNone
+		}
+	}
+	compressed := &bytes.Buffer{}
+	zw, _ := gzip.NewWriterLevel(compressed, gzip.BestSpeed)
+	zw.Write(sample)
+	zw.Close()
+	if compressed.Len() > len(sample)*95/100 {
+		return CompressionNone
+	}
+	return CompressionGzip
+}
+
+// compressWriter compresses the data written into the encrypt writer
+type compressWriter struct {
+	io.WriteCloser
+	encrypt io.WriteCloser
+}
+
+func (c *compressWriter) Close() error {
+	err := c.WriteCloser.Close()
+	if errc := c.encrypt.Close(); err == nil {
+		err = errc
+	}
+	return err
+}
+
+// autoCompressWriter buffers the first data written to choose the compression, then creates the encrypt writer
+type autoCompressWriter struct {
+	sample []byte
+	create func(compression string) (io.WriteCloser, error)
+	w      io.WriteCloser
+}
+
+func (a *autoCompressWriter) Write(p []byte) (int, error) {
+	if a.w != nil {
+		return a.w.Write(p)
+	}
+	n := len(p)
+	if n > compressionSample-len(a.sample) {
+		n = compressionSample - len(a.sample)
+	}
+	a.sample = append(a.sample, p[:n]...)
+	if len(a.sample) < compressionSample {
+		return n, nil
+	}
+	if err := a.start(); err != nil {
+		return 0, err
+	}
+	m, err := a.w.Write(p[n:])
+	return n + m, err
+}
+
+func (a *autoCompressWriter) start() error {
+	w, err := a.create(detectCompression(a.sample))
+	if err != nil {
+		return err
+	}
+	a.w = w
+	_, err = w.Write(a.sample)
+	a.sample = nil
+	return err
+}
+
+func (a *autoCompressWriter) Close() error {
+	if a.w == nil {
+		if err := a.start(); err != nil {
+			return err
+		}
+	}
+	return a.w.Close()
+}
+
+// decompressReader uncompresses the decrypted data, the gzip or zstd header is read on the first Read. The
+// decrypted data are read to the end, which authenticates them
+type decompressReader struct {
+	compression string
+	r           *bufio.Reader
+	zr          io.Reader
+}
+
+func newDecompressReader(r io.Reader, compression string) *decompressReader {
+	return &decompressReader{compression: compression, r: bufio.NewReader(r)}
+}
+
+func (d *decompressReader) Read(p []byte) (int, error) {
+	if d.zr == nil {
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := d.zr.Read(p)
+	if closer, ok := d.zr.(io.Closer); ok && err != nil {
+		closer.Close()
+	}
+	if err == io.EOF {
+		extra, errc := io.Copy(ioutil.Discard, d.r)
+		if errc != nil {
+			return n, errc
+		}
+		if extra > 0 {
+			return n, fmt.Errorf("corrupted data: %d bytes after the compressed data", extra)
+		}
+	}
+	return n, err
+}
+
+func (d *decompressReader) open() error {
+	if d.compression == CompressionZstd {
+		//a single goroutine: the decrypted data are read in order and the reader is released at the end
+		zr, err := zstd.NewReader(d.r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		d.zr = zr.IOReadCloser()
+		return nil
+	}
+	zr, err := gzip.NewReader(d.r)
+	if err != nil {
+		return err
+	}
+	zr.Multistream(false)
+	d.zr = zr
+	return nil
+}
+
+// lengthReader checks the size of the data read against the original size at the end
+type lengthReader struct {
+	r      io.Reader
+	length int64
+	n      int64
+}
+
+func (l *lengthReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if err == io.EOF && l.n != l.length {
+		return n, fmt.Errorf("decrypted size %d doesn't match the original size %d", l.n, l.length)
+	}
+	return n, err
+}
@@ -0,0 +1,240 @@
+package rsa
+
+import (
+	gorsa "crypto/rsa"
+	"fmt"
+	"math/big"
+)
+
+// CRT values of a private key, the same as crypto/rsa.PrecomputedValues
+type precomputedValues struct {
+	dp, dq *big.Int //d mod (p-1), d mod (q-1)
+	qinv   *big.Int //q^-1 mod p
+	//for the 3rd and next primes of multi-prime keys
+	crtValues []crtValue
+}
+
+type crtValue struct {
+	exp   *big.Int //d mod (prime-1)
+	coeff *big.Int //r*coeff = 1 mod prime
+	r     *big.Int //product of the previous primes
+}
+
+// check the primes and compute their CRT values
+func (k *PrivateKey) precompute() error {
+	if len(k.primes) < 2 {
+		return fmt.Errorf("a private key needs at least 2 primes, got %d", len(k.primes))
+	}
+	product := big.NewInt(1)
+	for _, prime := range k.primes {
+		if prime == nil || prime.Cmp(one) <= 0 {
+			return fmt.Errorf("invalid prime factor")
+		}
+		product.Mul(product, prime)
+	}
+	if product.Cmp(k.nn) != 0 {
+		return fmt.Errorf("the product of the primes is not the modulus")
+	}
+	tmp := big.NewInt(0)
+	values := &precomputedValues{
+		dp:   big.NewInt(0).Mod(k.dd, tmp.Sub(k.primes[0], one)),
+		dq:   big.NewInt(0).Mod(k.dd, tmp.Sub(k.primes[1], one)),
+		qinv: big.NewInt(0).ModInverse(k.primes[1], k.primes[0]),
+	}
+	if values.qinv == nil {
+		return fmt.Errorf("prime factors are not relatively prime")
+	}
+	r := big.NewInt(0).Mul(k.primes[0], k.primes[1])
+	for _, prime := range k.primes[2:] {
+		value := crtValue{
+			exp:   big.NewInt(0).Mod(k.dd, tmp.Sub(prime, one)),
+			coeff: big.NewInt(0).ModInverse(r, prime),
+			r:     big.NewInt(0).Set(r),
+		}
+		if value.coeff == nil {
+			return fmt.Errorf("prime factors are not relatively prime")
+		}
+		values.crtValues = append(values.crtValues, value)
+		r.Mul(r, prime)
+	}
+	k.precomputed = values
+	return nil
+}
+
+func FromCryptoPublicKey(key *gorsa.PublicKey) (*PublicKey, error) {
+	if key == nil || key.N == nil {
+		return nil, fmt.Errorf("missing public modulus")
+	}
+	if key.E < 3 || key.E%2 == 0 {
+		return nil, fmt.Errorf("invalid public exponent: %d", key.E)
+	}
+	return &PublicKey{nn: big.NewInt(0).Set(key.N), ee: big.NewInt(int64(key.E))}, nil
+}
+
+// FromCryptoPrivateKey refuses the keys crypto/rsa Validate rejects. The CRT values are computed from the primes, the
+// precomputed values of key must match them: a wrong CRT value gives wrong signatures which reveal a prime factor
+func FromCryptoPrivateKey(key *gorsa.PrivateKey) (*PrivateKey, error) {
+	if key == nil {
+		return nil, fmt.Errorf("missing private key")
+	}
+	publicKey, err := FromCryptoPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if key.D == nil || key.D.Sign() <= 0 {
+		return nil, fmt.Errorf("missing private exponent")
+	}
+	privateKey := &PrivateKey{nn: publicKey.nn, ee: publicKey.ee, dd: big.NewInt(0).Set(key.D)}
+	if len(key.Primes) == 0 {
+		//crypto/rsa needs the primes to validate the key, they are recovered from n, e and d
+		primes, err := recoverPrimes(privateKey.nn, privateKey.ee, privateKey.dd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %v", err)
+		}
+		complete := gorsa.PrivateKey{PublicKey: key.PublicKey, D: key.D, Primes: primes}
+		if err := complete.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid private key: %v", err)
+		}
+		return privateKey, nil
+	}
+	if err := key.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	for _, prime := range key.Primes {
+		if prime == nil {
+			return nil, fmt.Errorf("invalid prime factor")
+		}
+		privateKey.primes = append(privateKey.primes, big.NewInt(0).Set(prime))
+	}
+	if err := privateKey.precompute(); err != nil {
+		return nil, err
+	}
+	if err := privateKey.precomputed.check(&key.Precomputed); err != nil {
+		return nil, err
+	}
+	return privateKey, nil
+}
+
+// compares the values set in pre with the values computed from the primes
+func (v *precomputedValues) check(pre *gorsa.PrecomputedValues) error {
+	for _, value := range [][2]*big.Int{{pre.Dp, v.dp}, {pre.Dq, v.dq}, {pre.Qinv, v.qinv}} {
+		if value[0] != nil && value[0].Cmp(value[1]) != 0 {
+			return fmt.Errorf("invalid private key: the precomputed CRT values don't match the primes")
+		}
+	}
+	if len(pre.CRTValues) != 0 && len(pre.CRTValues) != len(v.crtValues) {
+		return fmt.Errorf("invalid private key: %d precomputed CRT values for %d primes", len(pre.CRTValues), len(v.crtValues)+2)
+	}
+	for i, value := range pre.CRTValues {
+		computed := v.crtValues[i]
+		for _, pair := range [][2]*big.Int{{value.Exp, computed.exp}, {value.Coeff, computed.coeff}, {value.R, computed.r}} {
+			if pair[0] != nil && pair[0].Cmp(pair[1]) != 0 {
+				return fmt.Errorf("invalid private key: the precomputed CRT values don't match the primes")
+			}
+		}
+	}
+	return nil
+}
+
+func (k *PublicKey) ToCryptoPublicKey() (*gorsa.PublicKey, error) {
+	return toCryptoPublicKey(k.nn, k.ee)
+}
+
+func toCryptoPublicKey(nn *big.Int, ee *big.Int) (*gorsa.PublicKey, error) {
+	if ee == nil {
+		return nil, fmt.Errorf("the public exponent is unknown, load the private key with GetKeys")
+	}
+	//crypto/rsa only accepts exponents in a 32 bits signed int
+	if !ee.IsInt64() || ee.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("public exponent too large for crypto/rsa (%d bits, 31 maximum), create the keys with CreateRSAKeyWithExponent", ee.BitLen())
+	}
+	if ee.Bit(0) == 0 || ee.Int64() < 3 {
+		return nil, fmt.Errorf("public exponent %d rejected by crypto/rsa, it should be odd and greater than 2", ee.Int64())
+	}
+	if nn.Bit(0) == 0 {
+		return nil, fmt.Errorf("even modulus rejected by crypto/rsa")
+	}
+	return &gorsa.PublicKey{N: big.NewInt(0).Set(nn), E: int(ee.Int64())}, nil
+}
+
+// ToCryptoPrivateKey returns a crypto/rsa key having the same primes and CRT values.
+// The primes of keys saved without them are recovered from n, e and d
+func (k *PrivateKey) ToCryptoPrivateKey() (*gorsa.PrivateKey, error) {
+	publicKey, err := toCryptoPublicKey(k.nn, k.ee)
+	if err != nil {
+		return nil, err
+	}
+	primes, precomputed := k.primes, k.precomputed
+	if primes == nil {
+		recovered := &PrivateKey{nn: k.nn, dd: k.dd, ee: k.ee}
+		if recovered.primes, err = recoverPrimes(k.nn, k.ee, k.dd); err != nil {
+			return nil, err
+		}
+		if err := recovered.precompute(); err != nil {
+			return nil, err
+		}
+		primes, precomputed = recovered.primes, recovered.precomputed
+	}
+	key := &gorsa.PrivateKey{
+		PublicKey: *publicKey,
+		D:         big.NewInt(0).Set(k.dd),
+		Precomputed: gorsa.PrecomputedValues{
+			Dp:   big.NewInt(0).Set(precomputed.dp),
+			Dq:   big.NewInt(0).Set(precomputed.dq),
+			Qinv: big.NewInt(0).Set(precomputed.qinv),
+		},
+	}
+	for _, prime := range primes {
+		key.Primes = append(key.Primes, big.NewInt(0).Set(prime))
+	}
+	for _, value := range precomputed.crtValues {
+		key.Precomputed.CRTValues = append(key.Precomputed.CRTValues, gorsa.CRTValue{
+			Exp:   big.NewInt(0).Set(value.exp),
+			Coeff: big.NewInt(0).Set(value.coeff),
+			R:     big.NewInt(0).Set(value.r),
+		})
+	}
+	key.Precompute()
+	if err := key.Validate(); err != nil {
+		return nil, fmt.Errorf("key rejected by crypto/rsa: %v", err)
+	}
+	return key, nil
+}
+
+// factor n knowing e and d (RFC 8017 is silent about it, see NIST SP 800-56B appendix C)
+func recoverPrimes(nn *big.Int, ee *big.Int, dd *big.Int) ([]*big.Int, error) {
+	//k = d*e-1 is a multiple of lambda(n), k = 2^t * r
+	kk := big.NewInt(0).Mul(dd, ee)
+	kk.Sub(kk, one)
+	if kk.Sign() <= 0 || kk.Bit(0) != 0 {
+		return nil, fmt.Errorf("can't recover the primes, d and e don't match")
+	}
+	t := 0
+	for kk.Bit(t) == 0 {
+		t++
+	}
+	r := big.NewInt(0).Rsh(kk, uint(t))
+	nn1 := big.NewInt(0).Sub(nn, one)
+	y := big.NewInt(0)
+	x := big.NewInt(0)
+	for g := int64(2); g < 100; g++ {
+		y.Exp(big.NewInt(g), r, nn)
+		if y.Cmp(one) == 0 || y.Cmp(nn1) == 0 {
+			continue
+		}
+		for i := 0; i < t; i++ {
+			x.Exp(y, two, nn)
+			if x.Cmp(one) == 0 {
+				//y is a non trivial square root of 1
+				p := big.NewInt(0).GCD(nil, nil, y.Sub(y, one), nn)
+				q := big.NewInt(0).Div(nn, p)
+				return []*big.Int{p, q}, nil
+			}
+			if x.Cmp(nn1) == 0 {
+				break
+			}
+			y.Set(x)
+		}
+	}
+	return nil, fmt.Errorf("can't recover the primes from the key")
+}
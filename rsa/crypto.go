@@ -0,0 +1,71 @@
+package rsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	gorsa "crypto/rsa"
+	"crypto/subtle"
+	"fmt"
+	"io"
+)
+
+// PrivateKey can be used where the standard library expects a crypto.Signer or a crypto.Decrypter (crypto/tls, crypto/x509, ...)
+var (
+	_ crypto.Signer    = (*PrivateKey)(nil)
+	_ crypto.Decrypter = (*PrivateKey)(nil)
+)
+
+// Public returns a *crypto/rsa.PublicKey, or a *PublicKey if the public exponent is too large for crypto/rsa.
+// It returns nil if the key has been loaded without its public exponent
+func (k *PrivateKey) Public() crypto.PublicKey {
+	if k.ee == nil {
+		return nil
+	}
+	if publicKey, err := toCryptoPublicKey(k.nn, k.ee); err == nil {
+		return publicKey
+	}
+	return k.PublicKey()
+}
+
+// PublicKey returns the public part of the key, nil if the key has been loaded without its public exponent
+func (k *PrivateKey) PublicKey() *PublicKey {
+	if k.ee == nil {
+		return nil
+	}
+	return &PublicKey{nn: k.nn, ee: k.ee}
+}
+
+// Decrypt implements crypto.Decrypter. opts can be nil or *crypto/rsa.PKCS1v15DecryptOptions for RSAES-PKCS1-v1_5,
+// or *crypto/rsa.OAEPOptions for RSAES-OAEP.
+// Use DecryptRaw to decrypt data encrypted with PublicKey.Encrypt
+func (k *PrivateKey) Decrypt(random io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	switch opts := opts.(type) {
+	case nil:
+		return k.DecryptPKCS1v15(ciphertext)
+	case *gorsa.PKCS1v15DecryptOptions:
+		if opts.SessionKeyLen == 0 {
+			return k.DecryptPKCS1v15(ciphertext)
+		}
+		//same as crypto/rsa: a random session key is returned when padding or length are wrong
+		if random == nil {
+			random = rand.Reader
+		}
+		key := make([]byte, opts.SessionKeyLen)
+		if _, err := io.ReadFull(random, key); err != nil {
+			return nil, err
+		}
+		msg, err := k.DecryptPKCS1v15Implicit(ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		subtle.ConstantTimeCopy(subtle.ConstantTimeEq(int32(len(msg)), int32(len(key))), key, leftPad(msg, len(key))[:len(key)])
+		return key, nil
+	case *gorsa.OAEPOptions:
+		mgfHash := opts.MGFHash
+		if mgfHash == 0 {
+			mgfHash = opts.Hash
+		}
+		return k.decryptOAEP(opts.Hash, mgfHash, ciphertext, opts.Label)
+	}
+	return nil, fmt.Errorf("unsupported decrypter options: %T", opts)
+}
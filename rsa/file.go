@@ -0,0 +1,261 @@
+package rsa
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+)
+
+type EncryptOptions struct {
+	//ModeRSA (default), ModeOAEP or ModeHybrid
+	Mode string
+	//public key paths of more recipients, in hybrid mode only
+	Recipients []string
+	//number of goroutines encrypting the blocks, one if lower than 2
+	Workers int
+	//called after each block encrypted, see Progress
+	Progress func(Progress)
+	//CompressionNone (default), CompressionGzip, CompressionZstd or CompressionAuto
+	Compression string
+	//ASCII armored output, see NewArmorWriter
+	Armor bool
+	//store the name, permission bits and modification time of the source file in the encrypted data, see
+	//DecryptOptions.RestoreMetadata. Used by the file functions only
+	Metadata bool
+}
+
+func EncryptFile(sourcePath string, targetPath string, keyPath string) error {
+	return EncryptFileWithOptions(sourcePath, targetPath, keyPath, nil)
+}
+
+func EncryptFileWithOptions(sourcePath string, targetPath string, keyPath string, options *EncryptOptions) error {
+	return EncryptFileContext(context.Background(), sourcePath, targetPath, keyPath, options)
+}
+
+// EncryptFileContext stops with the error of ctx when it is cancelled
+func EncryptFileContext(ctx context.Context, sourcePath string, targetPath string, keyPath string, options *EncryptOptions) error {
+	filei, errf := os.Open(sourcePath)
+	if errf != nil {
+		return errf
+	}
+	defer filei.Close()
+	var metadata []byte
+	if options != nil && options.Metadata {
+		info, err := filei.Stat()
+		if err != nil {
+			return err
+		}
+		if metadata, err = fileMetadata(sourcePath, info); err != nil {
+			return err
+		}
+	}
+	fileo, errf := os.Create(targetPath)
+	if errf != nil {
+		return errf
+	}
+	defer fileo.Close()
+	if err := encryptStream(ctx, filei, fileo, keyPath, options, metadata); err != nil {
+		return err
+	}
+	return fileo.Close()
+}
+
+// EncryptStreamContext encrypts source into target as EncryptFileContext does, for pipes. The original size is
+// recorded in the header when source is a regular file, target is not closed
+func EncryptStreamContext(ctx context.Context, source io.Reader, target io.Writer, keyPath string, options *EncryptOptions) error {
+	return encryptStream(ctx, source, target, keyPath, options, nil)
+}
+
+// metadata are written before the data of source if not nil
+func encryptStream(ctx context.Context, source io.Reader, target io.Writer, keyPath string, options *EncryptOptions, metadata []byte) error {
+	options, publicKeys, err := encryptionKeys(keyPath, options)
+	if err != nil {
+		return err
+	}
+	length := int64(-1)
+	if file, ok := source.(*os.File); ok {
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		if offset, err := file.Seek(0, io.SeekCurrent); err == nil && info.Mode().IsRegular() {
+			length = info.Size() - offset
+		}
+	}
+	data := bufio.NewReaderSize(source, compressionSample)
+	if options.Compression == CompressionAuto {
+		sample, _ := data.Peek(compressionSample)
+		options.Compression = detectCompression(sample)
+	}
+	base := fileHeader{Length: length}
+	if metadata != nil {
+		base.Content = contentFile
+		if length >= 0 {
+			base.Length += int64(len(metadata))
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w, err := newEncryptWriter(ctx, target, publicKeys, options, base)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(metadata); err != nil {
+		w.Close()
+		return err
+	}
+	if _, err := io.Copy(w, data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// returns a copy of options with the mode chosen and the public keys of keyPath and of the recipients
+func encryptionKeys(keyPath string, options *EncryptOptions) (*EncryptOptions, []*PublicKey, error) {
+	copy := EncryptOptions{}
+	if options != nil {
+		copy = *options
+	}
+	if copy.Mode == "" && len(copy.Recipients) > 0 {
+		copy.Mode = ModeHybrid
+	}
+	keyPaths := copy.Recipients
+	if keyPath != "" {
+		keyPaths = append([]string{keyPath}, keyPaths...)
+	}
+	if err := checkMode(copy.Mode, len(keyPaths)); err != nil {
+		return nil, nil, err
+	}
+	if err := checkCompression(copy.Compression); err != nil {
+		return nil, nil, err
+	}
+	publicKeys, err := getPublicKeys(keyPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &copy, publicKeys, nil
+}
+
+// DecryptFile detects the mode of the file and checks the key before writing anything. The plaintext is written
+// in a temporary file renamed to targetPath once the whole file is authenticated, nothing is left on failure.
+// Files without MAC written by the previous versions are refused, see DecryptOptions.AllowUnauthenticated.
+// With DecryptOptions.RestoreMetadata, targetPath may be a directory where the file gets its original name
+func DecryptFile(sourcePath string, targetPath string, keyPath string) error {
+	return DecryptFileWithOptions(sourcePath, targetPath, keyPath, nil)
+}
+
+func DecryptFileWithOptions(sourcePath string, targetPath string, keyPath string, options *DecryptOptions) error {
+	return DecryptFileContext(context.Background(), sourcePath, targetPath, keyPath, options)
+}
+
+// DecryptFileContext stops with the error of ctx when it is cancelled
+func DecryptFileContext(ctx context.Context, sourcePath string, targetPath string, keyPath string, options *DecryptOptions) error {
+	filei, errf := os.Open(sourcePath)
+	if errf != nil {
+		return errf
+	}
+	defer filei.Close()
+	if options != nil && options.RestoreMetadata {
+		return decryptRestoringMetadata(func(w io.Writer) (*ArchiveEntry, error) {
+			return decryptStream(ctx, filei, w, keyPath, options)
+		}, targetPath)
+	}
+	return writeFileAtomic(targetPath, func(w io.Writer) error {
+		return DecryptStreamContext(ctx, filei, w, keyPath, options)
+	})
+}
+
+// DecryptStreamContext decrypts source into target as it is read, for pipes. The end of source authenticates the
+// data: if an error is returned, what has been written into target must be discarded. The metadata of the file
+// are not restored
+func DecryptStreamContext(ctx context.Context, source io.Reader, target io.Writer, keyPath string, options *DecryptOptions) error {
+	_, err := decryptStream(ctx, source, target, keyPath, options)
+	return err
+}
+
+// returns the metadata of the file, nil if it has none
+func decryptStream(ctx context.Context, source io.Reader, target io.Writer, keyPath string, options *DecryptOptions) (*ArchiveEntry, error) {
+	privateKey, errp := GetPrivateKey(keyPath)
+	if errp != nil {
+		return nil, errp
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r, header, err := newDecryptReader(ctx, source, privateKey, options)
+	if err != nil {
+		return nil, err
+	}
+	if header.Content == contentArchive {
+		return nil, fmt.Errorf("the file is a directory archive, use decryptDir")
+	}
+	var metadata *ArchiveEntry
+	if header.Content == contentFile {
+		if metadata, err = readMetadata(r); err != nil {
+			return nil, err
+		}
+	}
+	_, err = io.Copy(target, r)
+	return metadata, err
+}
+
+// writes a temporary file in the directory of path and renames it to path if write succeeds, removes it otherwise.
+// The file has the permissions of a file made by os.Create, 0666 minus the umask
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := createTempFile(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := write(tmp); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// creates a new file named after path in its directory, unlike ioutil.TempFile the umask gives its permissions
+func createTempFile(path string) (*os.File, error) {
+	suffix := make([]byte, 8)
+	for {
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		tmp, err := os.OpenFile(fmt.Sprintf("%s.tmp%x", path, suffix), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !os.IsExist(err) {
+			return tmp, err
+		}
+	}
+}
+
+// replaces the existing file path like writeFileAtomic, the new file keeps the permissions of path
+func replaceFileAtomic(path string, write func(io.Writer) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		if err := write(w); err != nil {
+			return err
+		}
+		return w.(*os.File).Chmod(info.Mode().Perm())
+	})
+}
+
+func getPublicKeys(paths []string) ([]*PublicKey, error) {
+	publicKeys := []*PublicKey{}
+	for _, path := range paths {
+		publicKey, err := GetPublicKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	return publicKeys, nil
+}
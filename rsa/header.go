@@ -0,0 +1,154 @@
+package rsa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Encrypted files start with:
+// magic "CIPHER" | version (1 byte) | header length (4 bytes big endian) | header (json)
+// Files written by the previous versions have no header, they are pure RSA files
+const (
+	fileMagic   = "CIPHER"
+	fileVersion = 1
+	//sanity limit on the header size
+	maxHeaderSize = 1 << 20
+)
+
+const (
+	ModeRSA    = "rsa"
+	ModeOAEP   = "rsa-oaep"
+	ModeHybrid = "hybrid"
+)
+
+type fileHeader struct {
+	//format version read before the json header, marshal writes fileVersion
+	Version int    `json:"-"`
+	Mode    string `json:"mode"`
+	//size of the original file, -1 if unknown
+	Length int64 `json:"length"`
+	//compression of the data before encryption, empty if not compressed
+	Compression string `json:"compression,omitempty"`
+	//contentArchive for a directory archive, contentFile for a file with its metadata, empty for a file
+	Content string `json:"content,omitempty"`
+	//pure RSA modes: size of the encrypted blocks and fingerprint of the key
+	BlockSize   int    `json:"blockSize,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	//pure RSA modes: MAC of the file and its key encapsulated with RSA-KEM, files without it are not authenticated
+	MAC    string `json:"mac,omitempty"`
+	MACKey []byte `json:"macKey,omitempty"`
+	//pure RSA modes: block tree written after the trailer for the verification of ranges and number of blocks by leaf
+	Tree        string `json:"tree,omitempty"`
+	TreeSegment int    `json:"treeSegment,omitempty"`
+	//hybrid mode: symmetric cipher of the body, plaintext chunk size and file key wrapped for each recipient
+	Cipher     string      `json:"cipher,omitempty"`
+	ChunkSize  int         `json:"chunkSize,omitempty"`
+	Recipients []recipient `json:"recipients,omitempty"`
+}
+
+// the file key wrapped with RSA-OAEP for the public key having the fingerprint
+type recipient struct {
+	Fingerprint string `json:"fingerprint"`
+	WrappedKey  []byte `json:"wrappedKey"`
+}
+
+// returns the bytes of the header as written in the file
+func (h *fileHeader) marshal() ([]byte, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return headerBytes(data), nil
+}
+
+// returns the header without the recipient table, authenticated with the body so that recipients
+// can be added or removed without encrypting the body again
+func (h *fileHeader) authenticatedData() []byte {
+	tmp := *h
+	tmp.Recipients = nil
+	data, _ := json.Marshal(&tmp)
+	return headerBytes(data)
+}
+
+func headerBytes(data []byte) []byte {
+	raw := bytes.NewBufferString(fileMagic)
+	raw.WriteByte(fileVersion)
+	binary.Write(raw, binary.BigEndian, uint32(len(data)))
+	raw.Write(data)
+	return raw.Bytes()
+}
+
+// reads the header, magic bytes included
+func readHeader(r io.Reader) (*fileHeader, error) {
+	raw := make([]byte, len(fileMagic)+5)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, fmt.Errorf("can't read file header: %v", err)
+	}
+	if string(raw[:len(fileMagic)]) != fileMagic {
+		return nil, fmt.Errorf("not a cipher file")
+	}
+	version := raw[len(fileMagic)]
+	if version != fileVersion {
+		return nil, fmt.Errorf("unsupported file format version %d", version)
+	}
+	size := binary.BigEndian.Uint32(raw[len(fileMagic)+1:])
+	if size > maxHeaderSize {
+		return nil, fmt.Errorf("invalid file header size %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("can't read file header: %v", err)
+	}
+	header := &fileHeader{Version: int(version), Length: -1}
+	if err := json.Unmarshal(data, header); err != nil {
+		return nil, fmt.Errorf("invalid file header: %v", err)
+	}
+	if header.Content != "" && header.Content != contentArchive && header.Content != contentFile {
+		return nil, fmt.Errorf("unsupported content: %s", header.Content)
+	}
+	if header.Compression != "" && header.Compression != CompressionGzip && header.Compression != CompressionZstd {
+		return nil, fmt.Errorf("unsupported compression: %s", header.Compression)
+	}
+	switch header.Mode {
+	case ModeRSA, ModeOAEP:
+		if header.BlockSize <= 1 {
+			return nil, fmt.Errorf("invalid block size: %d", header.BlockSize)
+		}
+		if header.MAC != "" && header.MAC != fileMAC {
+			return nil, fmt.Errorf("unsupported MAC: %s", header.MAC)
+		}
+		if header.Tree != "" && (header.Tree != fileTree || header.TreeSegment <= 0 || header.MAC == "" || header.Length < 0 || header.Compression != "") {
+			return nil, fmt.Errorf("unsupported block tree: %s", header.Tree)
+		}
+	case ModeHybrid:
+		if len(header.Recipients) == 0 {
+			return nil, fmt.Errorf("no recipient in the file header")
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode: %s", header.Mode)
+	}
+	return header, nil
+}
+
+// checks that the file has been encrypted for the private key. Keys without e have no fingerprint,
+// only their size is checked
+func (h *fileHeader) checkKey(privateKey *PrivateKey) error {
+	fingerprint := privateKey.fingerprint()
+	switch h.Mode {
+	case ModeRSA, ModeOAEP:
+		if fingerprint != "" && h.Fingerprint != "" && fingerprint != h.Fingerprint {
+			return fmt.Errorf("the file is encrypted for the key %s, not for this key (%s)", h.Fingerprint, fingerprint)
+		}
+		if size, _ := rsaBlockSizes(h.Mode, privateKey.nn); h.BlockSize != size {
+			return fmt.Errorf("the file is encrypted for a %d bits key, not for this %d bits key", h.BlockSize*8, privateKey.nn.BitLen())
+		}
+	case ModeHybrid:
+		if fingerprint != "" && !h.hasRecipient(fingerprint) {
+			return fmt.Errorf("the file is not encrypted for this key (fingerprint %s)", fingerprint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package rsa
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Hybrid mode: a random AES-256 file key wrapped with RSA-OAEP for each recipient in the header, and the body encrypted
+// with AES-GCM by chunks. The nonce of a chunk is its number followed by a flag set on the last chunk, and the header
+// without its recipient table is the additional data of every chunk, so that chunks can't be reordered, dropped or
+// truncated, nor the header changed. The last chunk is always shorter than the chunk size, it is empty when the size of the file is a multiple of it
+const (
+	hybridCipher    = "aes-256-gcm"
+	hybridChunkSize = 64 * 1024
+	fileKeySize     = 32
+	//GCM tag at the end of each chunk
+	hybridTagSize = 16
+)
+
+type hybridWriter struct {
+	out     *blockWriter
+	aead    cipher.AEAD
+	ad      []byte
+	chunk   []byte
+	counter uint64
+}
+
+// header holds the mode and the common fields
+func newHybridWriter(ctx context.Context, w io.Writer, publicKeys []*PublicKey, header *fileHeader, workers int, progress *progress) (*hybridWriter, error) {
+	fileKey := make([]byte, fileKeySize)
+	if _, err := io.ReadFull(rand.Reader, fileKey); err != nil {
+		return nil, err
+	}
+	header.Cipher, header.ChunkSize = hybridCipher, hybridChunkSize
+	for _, publicKey := range publicKeys {
+		entry, err := wrapFileKey(publicKey, fileKey)
+		if err != nil {
+			return nil, err
+		}
+		header.Recipients = append(header.Recipients, entry)
+	}
+	raw, err := header.marshal()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newChunkCipher(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	out := newBlockWriter(ctx, w, workers)
+	out.progress = progress
+	return &hybridWriter{out: out, aead: aead, ad: header.authenticatedData(), chunk: make([]byte, 0, hybridChunkSize)}, nil
+}
+
+func (e *hybridWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.chunk[len(e.chunk):hybridChunkSize], p)
+		e.chunk = e.chunk[:len(e.chunk)+n]
+		p = p[n:]
+		written += n
+		//the last chunk is shorter, a full chunk is never the last one
+		if len(e.chunk) == hybridChunkSize {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (e *hybridWriter) flush(last bool) error {
+	chunk := append(make([]byte, 0, len(e.chunk)+e.aead.Overhead()), e.chunk...)
+	nonce := chunkNonce(e.counter, last)
+	e.counter++
+	e.chunk = e.chunk[:0]
+	return e.out.write(func() ([]byte, error) {
+		return e.aead.Seal(chunk[:0], nonce, chunk, e.ad), nil
+	})
+}
+
+func (e *hybridWriter) Close() error {
+	err := e.flush(true)
+	if errc := e.out.close(); err == nil {
+		err = errc
+	}
+	return err
+}
+
+type hybridReader struct {
+	r         io.Reader
+	aead      cipher.AEAD
+	ad        []byte
+	chunkSize int
+	counter   uint64
+	done      bool
+}
+
+func newHybridReader(r io.Reader, privateKey *PrivateKey, header *fileHeader) (*hybridReader, error) {
+	if header.Cipher != hybridCipher {
+		return nil, fmt.Errorf("unsupported cipher: %s", header.Cipher)
+	}
+	if header.ChunkSize <= 0 || header.ChunkSize > maxHeaderSize {
+		return nil, fmt.Errorf("invalid chunk size: %d", header.ChunkSize)
+	}
+	fileKey, err := header.unwrapFileKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newChunkCipher(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return &hybridReader{r: r, aead: aead, ad: header.authenticatedData(), chunkSize: header.ChunkSize + aead.Overhead()}, nil
+}
+
+func (d *hybridReader) next() (blockTask, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+	chunk := make([]byte, d.chunkSize)
+	n, err := io.ReadFull(d.r, chunk)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	d.done = n < len(chunk)
+	counter, nonce := d.counter, chunkNonce(d.counter, d.done)
+	d.counter++
+	return func() ([]byte, error) {
+		data, err := d.aead.Open(chunk[:0], nonce, chunk[:n], d.ad)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: authentication failed, the file is corrupted or truncated", counter)
+		}
+		return data, nil
+	}, nil
+}
+
+func newChunkCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunk number on 8 bytes then the last chunk flag
+func chunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
@@ -0,0 +1,218 @@
+package rsa
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// FileInfo is what InspectFile learns from an encrypted file without the key
+type FileInfo struct {
+	//format version, 0 for the files without header written by the previous versions
+	Version int
+	Armored bool
+	Mode    string
+	//contentArchive, contentFile or empty, compression of the data before encryption
+	Content     string
+	Compression string
+	//size of the original data, -1 if unknown, and of the encrypted file (without armor)
+	Length int64
+	Size   int64
+	//size of the encrypted blocks, of the plaintext chunks in hybrid mode, and their number
+	BlockSize int
+	Blocks    int64
+	//fingerprints of the keys the file is encrypted for
+	Fingerprints []string
+	MAC          string
+	Tree         string
+	Cipher       string
+	//inconsistencies found, as a size which doesn't match the blocks of a truncated file
+	Problems []string
+}
+
+// InspectFile reads the header of the encrypted file and counts its blocks, nothing is decrypted
+func InspectFile(path string) (*FileInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info := &FileInfo{Length: -1}
+	br := bufio.NewReader(file)
+	var r io.Reader = br
+	if isArmored(br) {
+		armor, _, err := NewArmorReader(br)
+		if err != nil {
+			return nil, err
+		}
+		info.Armored = true
+		r = bufio.NewReader(armor)
+	}
+	counter := &countReader{r: r}
+	if magic, _ := counter.peek(len(fileMagic)); string(magic) != fileMagic {
+		//legacy rsa mode file, the key size is unknown
+		info.Mode = ModeRSA
+		if _, err := io.Copy(ioutil.Discard, counter); err != nil {
+			return nil, err
+		}
+		info.Size = counter.n
+		info.Problems = append(info.Problems, "no header: written by a previous version, not authenticated, the key is unknown")
+		return info, nil
+	}
+	header, err := readHeader(counter)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := counter.n
+	if _, err := io.Copy(ioutil.Discard, counter); err != nil {
+		return nil, err
+	}
+	info.Version, info.Mode, info.Content, info.Compression = header.Version, header.Mode, header.Content, header.Compression
+	info.Length, info.Size, info.MAC, info.Tree, info.Cipher = header.Length, counter.n, header.MAC, header.Tree, header.Cipher
+	body := counter.n - headerSize
+	if header.Mode == ModeHybrid {
+		for _, entry := range header.Recipients {
+			info.Fingerprints = append(info.Fingerprints, entry.Fingerprint)
+		}
+		//the last chunk is shorter than the others, it holds at least the tag
+		info.BlockSize = header.ChunkSize
+		size := int64(header.ChunkSize + hybridTagSize)
+		info.Blocks = body/size + 1
+		if body%size < hybridTagSize {
+			info.Problems = append(info.Problems, fmt.Sprintf("the last chunk is too short (%d bytes): the file is truncated", body%size))
+		}
+		return info, nil
+	}
+	if header.Fingerprint != "" {
+		info.Fingerprints = []string{header.Fingerprint}
+	}
+	info.BlockSize = header.BlockSize
+	end := int64(rsaTrailerSize)
+	if header.MAC != "" {
+		end += macSize
+	}
+	if header.Tree != "" {
+		dataSize := rsaDataSize(header.Mode, header.BlockSize)
+		blocks := treeBlocks(header.Length, dataSize)
+		end += treeSectionSize(blocks, header.TreeSegment)
+	}
+	info.Blocks = (body - end) / int64(header.BlockSize)
+	if body < end || (body-end)%int64(header.BlockSize) != 0 {
+		info.Problems = append(info.Problems, fmt.Sprintf("%d bytes after the header don't make whole blocks of %d bytes: the file is truncated or corrupted", body, header.BlockSize))
+	}
+	return info, nil
+}
+
+// countReader counts the bytes read
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countReader) peek(n int) ([]byte, error) {
+	return c.r.(*bufio.Reader).Peek(n)
+}
+
+// VerifyError locates the corruption found by VerifyEncryptedFile
+type VerifyError struct {
+	//first bad block, chunk in hybrid mode, and number of blocks which may hold the corruption: the block tree only
+	//tells the segment. Block is -1 if the corruption can't be located: without block tree the MAC of the rsa and
+	//rsa-oaep modes covers the whole file
+	Block int64
+	Count int64
+	Err   error
+}
+
+func (e *VerifyError) Error() string {
+	if e.Block < 0 {
+		return e.Err.Error()
+	}
+	if e.Count > 1 {
+		return fmt.Sprintf("blocks %d to %d: %v", e.Block, e.Block+e.Count-1, e.Err)
+	}
+	return fmt.Sprintf("block %d: %v", e.Block, e.Err)
+}
+
+// VerifyEncryptedFile decrypts and authenticates the file in memory, nothing is written. It returns the number of blocks
+// verified, a *VerifyError if the file is corrupted
+func VerifyEncryptedFile(path string, keyPath string, options *DecryptOptions) (int64, error) {
+	return VerifyEncryptedFileContext(context.Background(), path, keyPath, options)
+}
+
+// VerifyEncryptedFileContext stops with the error of ctx when it is cancelled. When the verification of a rsa or rsa-oaep
+// mode file fails, the segments of its block tree are checked to locate the modification in its segment
+func VerifyEncryptedFileContext(ctx context.Context, path string, keyPath string, options *DecryptOptions) (int64, error) {
+	privateKey, err := GetPrivateKey(keyPath)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	copy := DecryptOptions{}
+	if options != nil {
+		copy = *options
+	}
+	blocks := int64(0)
+	callback := copy.Progress
+	copy.Progress = func(p Progress) {
+		blocks = p.Blocks
+		if callback != nil {
+			callback(p)
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r, header, err := newDecryptReader(ctx, file, privateKey, &copy)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		if ctx.Err() != nil {
+			return blocks, err
+		}
+		if header.Tree != "" {
+			if err := verifyTree(ctx, file, privateKey, copy.Workers); err != nil {
+				return blocks, err
+			}
+		}
+		//the MAC is checked after the last block
+		if header.Mode != ModeHybrid && err == ErrAuthentication {
+			return blocks, &VerifyError{Block: -1, Err: err}
+		}
+		return blocks, &VerifyError{Block: blocks, Count: 1, Err: err}
+	}
+	return blocks, nil
+}
+
+// checks every segment of blocks with the block tree
+func verifyTree(ctx context.Context, file io.ReaderAt, privateKey *PrivateKey, workers int) error {
+	d, _, err := openBlockTree(ctx, file, privateKey, workers)
+	if err == ErrAuthentication {
+		return &VerifyError{Block: -1, Err: fmt.Errorf("the block tree or the header has been modified: %v", err)}
+	}
+	if err != nil {
+		return err
+	}
+	for leaf := int64(0); leaf*d.segment < d.count; leaf++ {
+		if err := d.readLeaf(leaf); err != nil {
+			count := d.segment
+			if rest := d.count - leaf*d.segment; rest < count {
+				count = rest
+			}
+			return &VerifyError{Block: leaf * d.segment, Count: count, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package rsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+//RSA-KEM (ISO 18033-2 section 11.5, RFC 5990): a random z lower than n is encrypted with the public key
+//and the shared secret is derived from z with KDF2
+
+// default KDF hash and shared secret size, an AES-256 key
+const (
+	KEMHash      = crypto.SHA256
+	KEMSecretLen = 32
+)
+
+// Encapsulate returns a random shared secret of KEMSecretLen bytes and its encapsulation, to send to the owner
+// of the private key who gets the same secret with Decapsulate
+func (k *PublicKey) Encapsulate() (sharedSecret []byte, encapsulation []byte, err error) {
+	return k.EncapsulateWithKDF(rand.Reader, KEMHash, KEMSecretLen)
+}
+
+// EncapsulateWithKDF reads z in random and derives a secret of secretLen bytes with KDF2 over hash
+func (k *PublicKey) EncapsulateWithKDF(random io.Reader, hash crypto.Hash, secretLen int) (sharedSecret []byte, encapsulation []byte, err error) {
+	if !hash.Available() {
+		return nil, nil, fmt.Errorf("unsupported hash function: %v", hash)
+	}
+	if secretLen <= 0 {
+		return nil, nil, fmt.Errorf("invalid shared secret size: %d", secretLen)
+	}
+	size := k.size()
+	//z uniform in [0, n-1]: random bytes with the bit size of n, retried when larger than n
+	z := big.NewInt(0)
+	buf := make([]byte, size)
+	for {
+		if _, err := io.ReadFull(random, buf); err != nil {
+			return nil, nil, err
+		}
+		if extra := uint(size*8 - k.nn.BitLen()); extra > 0 {
+			buf[0] &= 0xff >> extra
+		}
+		if z.SetBytes(buf).Cmp(k.nn) < 0 {
+			break
+		}
+	}
+	encapsulation = leftPad(k.encrypt(z).Bytes(), size)
+	return kdf2(hash, leftPad(z.Bytes(), size), secretLen), encapsulation, nil
+}
+
+// Decapsulate returns the shared secret of an encapsulation made by Encapsulate
+func (k *PrivateKey) Decapsulate(encapsulation []byte) ([]byte, error) {
+	return k.DecapsulateWithKDF(encapsulation, KEMHash, KEMSecretLen)
+}
+
+func (k *PrivateKey) DecapsulateWithKDF(encapsulation []byte, hash crypto.Hash, secretLen int) ([]byte, error) {
+	if !hash.Available() {
+		return nil, fmt.Errorf("unsupported hash function: %v", hash)
+	}
+	if secretLen <= 0 {
+		return nil, fmt.Errorf("invalid shared secret size: %d", secretLen)
+	}
+	size := k.size()
+	if len(encapsulation) != size {
+		return nil, ErrDecryption
+	}
+	c := big.NewInt(0).SetBytes(encapsulation)
+	if c.Cmp(k.nn) >= 0 {
+		return nil, ErrDecryption
+	}
+	z, err := k.decrypt(c)
+	if err != nil {
+		return nil, err
+	}
+	return kdf2(hash, leftPad(z.Bytes(), size), secretLen), nil
+}
+
+// KDF2 of ISO 18033-2: hash(z || counter) for counter = 1, 2, ... on 4 bytes big endian
+func kdf2(hash crypto.Hash, z []byte, size int) []byte {
+	out := make([]byte, 0, size+hash.Size())
+	h := hash.New()
+	counter := make([]byte, 4)
+	for i := uint32(1); len(out) < size; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		h.Reset()
+		h.Write(z)
+		h.Write(counter)
+		out = h.Sum(out)
+	}
+	return out[:size]
+}
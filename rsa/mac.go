@@ -0,0 +1,58 @@
+package rsa
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// rsa mode files are authenticated with HMAC-SHA256 over the header, the data of each block and the trailer
+// preceded by their sequence number, and the original length. The key is encapsulated with RSA-KEM in the header
+// and the tag follows the trailer. Anybody can encapsulate a new key with the public key, so the tag covers the
+// data rather than the encrypted blocks: it can't be computed again for reordered or altered blocks without
+// decrypting them
+const (
+	fileMAC = "hmac-sha256"
+	macSize = sha256.Size
+)
+
+var (
+	ErrAuthentication  = errors.New("authentication failed: the file has been modified, truncated or its blocks reordered")
+	ErrUnauthenticated = errors.New("the file is not authenticated, it was written by a previous version or its header was altered")
+)
+
+type blockMAC struct {
+	mac hash.Hash
+	seq uint64
+}
+
+func newBlockMAC(key []byte, header []byte) *blockMAC {
+	m := &blockMAC{mac: hmac.New(sha256.New, key)}
+	m.mac.Write(header)
+	return m
+}
+
+func (m *blockMAC) add(block []byte) {
+	seq := make([]byte, 8)
+	binary.BigEndian.PutUint64(seq, m.seq)
+	m.mac.Write(seq)
+	m.mac.Write(block)
+	m.seq++
+}
+
+// tag of the blocks added and the original length
+func (m *blockMAC) sum(length uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, length)
+	m.mac.Write(buf)
+	return m.mac.Sum(nil)
+}
+
+func (m *blockMAC) check(length uint64, tag []byte) error {
+	if !hmac.Equal(m.sum(length), tag) {
+		return ErrAuthentication
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package rsa
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Files encrypted with EncryptOptions.Metadata: the data encrypted start with the metadata of the source file,
+// an ArchiveEntry holding its base name, permission bits, modification time and size, its length on 4 bytes big
+// endian then json, followed by the content of the file. The header only tells that the metadata are there
+const (
+	contentFile = "file"
+	//sanity limit on the metadata size
+	maxMetadataSize = 64 * 1024
+)
+
+// returns the metadata of the file as written before its content
+func fileMetadata(path string, info os.FileInfo) ([]byte, error) {
+	entry := ArchiveEntry{Path: filepath.Base(path), Type: EntryFile, Mode: info.Mode().Perm(), ModTime: info.ModTime(), Size: info.Size()}
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxMetadataSize {
+		return nil, fmt.Errorf("file name too long")
+	}
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(data)))
+	return append(size, data...), nil
+}
+
+// reads the metadata at the beginning of the decrypted data
+func readMetadata(r io.Reader) (*ArchiveEntry, error) {
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r, size); err != nil {
+		return nil, fmt.Errorf("can't read the file metadata: %v", err)
+	}
+	if binary.BigEndian.Uint32(size) > maxMetadataSize {
+		return nil, fmt.Errorf("corrupted data: invalid metadata size")
+	}
+	data := make([]byte, binary.BigEndian.Uint32(size))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("can't read the file metadata: %v", err)
+	}
+	entry := &ArchiveEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("corrupted file metadata: %v", err)
+	}
+	return entry, nil
+}
+
+// decrypts source in a temporary file, sets the mode and modification time of the metadata and renames it to
+// targetPath, or to the original name in targetPath if it is a directory. An existing file is not overwritten
+// with the original name
+func decryptRestoringMetadata(decrypt func(io.Writer) (*ArchiveEntry, error), targetPath string) error {
+	dir, target := filepath.Dir(targetPath), targetPath
+	if info, err := os.Stat(targetPath); err == nil && info.IsDir() {
+		dir, target = targetPath, ""
+	}
+	tmp, err := ioutil.TempFile(dir, "decrypted.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	metadata, err := decrypt(tmp)
+	if err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if metadata == nil {
+		return fmt.Errorf("the file has no metadata to restore, it was encrypted without them or from a pipe")
+	}
+	if target == "" {
+		name := metadata.Path
+		if name == "" || name == "." || name == ".." || name != filepath.Base(name) {
+			return fmt.Errorf("invalid original file name %q", name)
+		}
+		target = filepath.Join(dir, name)
+		if _, err := os.Lstat(target); err == nil {
+			return fmt.Errorf("%s already exists", target)
+		}
+	}
+	if err := os.Chmod(tmp.Name(), metadata.Mode.Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), metadata.ModTime, metadata.ModTime); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// RandomFileName returns a random name for an encrypted file which doesn't leak the name of the source file
+func RandomFileName() (string, error) {
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(name) + ".cipher", nil
+}
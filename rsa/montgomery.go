@@ -0,0 +1,306 @@
+package rsa
+
+import (
+	"errors"
+	"math/big"
+	"math/bits"
+)
+
+// Montgomery arithmetic on fixed size little endian words, R = 2^(wordSize*len(m)).
+// Operations on secret values don't branch on them and don't index memory with them
+type montContext struct {
+	modulus *big.Int
+	m       []uint
+	m0inv   uint   //-m^-1 mod 2^wordSize
+	rr      []uint //R^2 mod m
+	one     []uint //R mod m, 1 in Montgomery form
+}
+
+const windowSize = 4
+
+func newMontContext(modulus *big.Int) *montContext {
+	n := len(modulus.Bits())
+	c := &montContext{
+		modulus: big.NewInt(0).Set(modulus),
+		m:       toWords(modulus, n),
+	}
+	//Newton iteration, each step doubles the number of correct bits of the inverse
+	inv := c.m[0]
+	for i := 0; i < 6; i++ {
+		inv *= 2 - c.m[0]*inv
+	}
+	c.m0inv = -inv
+	r := big.NewInt(0).Lsh(one, uint(n*bits.UintSize))
+	c.one = toWords(big.NewInt(0).Mod(r, modulus), n)
+	c.rr = toWords(big.NewInt(0).Mod(r.Mul(r, r), modulus), n)
+	return c
+}
+
+func toWords(x *big.Int, n int) []uint {
+	words := make([]uint, n)
+	for i, w := range x.Bits() {
+		if i < n {
+			words[i] = uint(w)
+		}
+	}
+	return words
+}
+
+func fromWords(z []uint) *big.Int {
+	words := make([]big.Word, len(z))
+	for i, w := range z {
+		words[i] = big.Word(w)
+	}
+	return big.NewInt(0).SetBits(words)
+}
+
+// returns hi, lo of x*y + z + c, it can't overflow
+func mulAddWWW(x, y, z, c uint) (uint, uint) {
+	hi, lo := bits.Mul(x, y)
+	var cc uint
+	lo, cc = bits.Add(lo, z, 0)
+	hi += cc
+	lo, cc = bits.Add(lo, c, 0)
+	hi += cc
+	return hi, lo
+}
+
+// returns 1 if a == b, 0 otherwise
+func ctEq(a, b uint) uint {
+	x := a ^ b
+	return ((x | -x) >> (bits.UintSize - 1)) ^ 1
+}
+
+// z = x if v == 1, y if v == 0
+func ctSelect(v uint, z, x, y []uint) {
+	mask := -v
+	for i := range z {
+		z[i] = x[i]&mask | y[i]&^mask
+	}
+}
+
+// z = x*y/R mod m (FIOS), x and y should be lower than m. z can alias x or y, t is a scratch buffer of at least len(m)+1 words
+func (c *montContext) montMul(z, x, y, t []uint) {
+	n := len(c.m)
+	m := c.m
+	t = t[:n+1]
+	x = x[:n]
+	m = m[:n]
+	for i := range t {
+		t[i] = 0
+	}
+	for i := 0; i < n; i++ {
+		//t = (t + x*y[i] + mm*m) / 2^wordSize, mm chosen so that the division is exact
+		yi := y[i]
+		c1, lo := mulAddWWW(x[0], yi, t[0], 0)
+		mm := lo * c.m0inv
+		c2, _ := mulAddWWW(mm, m[0], lo, 0)
+		for j := 1; j < n; j++ {
+			c1, lo = mulAddWWW(x[j], yi, t[j], c1)
+			c2, t[j-1] = mulAddWWW(mm, m[j], lo, c2)
+		}
+		var cc1, cc2 uint
+		t[n-1], cc1 = bits.Add(t[n], c1, 0)
+		t[n-1], cc2 = bits.Add(t[n-1], c2, 0)
+		t[n] = cc1 + cc2
+	}
+	//t < 2m, subtract m if t >= m
+	var borrow uint
+	for i := 0; i < n; i++ {
+		z[i], borrow = bits.Sub(t[i], m[i], borrow)
+	}
+	ctSelect(t[n]|(borrow^1), z, z, t[:n])
+}
+
+// z = x - y mod m, x and y lower than m
+func (c *montContext) modSub(z, x, y []uint) {
+	var borrow, carry uint
+	for i := range z {
+		z[i], borrow = bits.Sub(x[i], y[i], borrow)
+	}
+	mask := -borrow
+	for i := range z {
+		z[i], carry = bits.Add(z[i], c.m[i]&mask, carry)
+	}
+}
+
+// z = x + y mod m, x and y lower than m
+func (c *montContext) modAdd(z, x, y []uint) {
+	n := len(c.m)
+	var carry, borrow uint
+	for i := 0; i < n; i++ {
+		z[i], carry = bits.Add(x[i], y[i], carry)
+	}
+	sub := make([]uint, n)
+	for i := 0; i < n; i++ {
+		sub[i], borrow = bits.Sub(z[i], c.m[i], borrow)
+	}
+	ctSelect(carry|(borrow^1), z, sub, z)
+}
+
+// returns x mod m in Montgomery form, in constant time for a given number of words of x
+func (c *montContext) toMont(x []uint) []uint {
+	n := len(c.m)
+	t := make([]uint, n+2)
+	acc := make([]uint, n)
+	chunk := make([]uint, n)
+	//Horner on chunks of n words: acc = acc*R + chunk
+	for top := (len(x) - 1) / n * n; top >= 0; top -= n {
+		for i := range chunk {
+			chunk[i] = 0
+		}
+		copy(chunk, x[top:])
+		c.montMul(acc, acc, c.rr, t)
+		c.montMul(chunk, chunk, c.rr, t)
+		c.modAdd(acc, acc, chunk)
+	}
+	return acc
+}
+
+func (c *montContext) fromMont(x []uint) []uint {
+	n := len(c.m)
+	unit := make([]uint, n)
+	unit[0] = 1
+	z := make([]uint, n)
+	c.montMul(z, x, unit, make([]uint, n+2))
+	return z
+}
+
+// returns x^e in Montgomery form, x being in Montgomery form. The exponent is read by windows of 4 bits
+// on ebits bits whatever its value, and the table of powers is read entirely at each step
+func (c *montContext) expMont(x []uint, e []uint, ebits int) []uint {
+	n := len(c.m)
+	t := make([]uint, n+2)
+	var table [1 << windowSize][]uint
+	table[0] = append([]uint(nil), c.one...)
+	table[1] = append([]uint(nil), x...)
+	for i := 2; i < len(table); i++ {
+		table[i] = make([]uint, n)
+		c.montMul(table[i], table[i-1], x, t)
+	}
+	acc := append([]uint(nil), c.one...)
+	entry := make([]uint, n)
+	ebits = (ebits + windowSize - 1) / windowSize * windowSize
+	for i := ebits - windowSize; i >= 0; i -= windowSize {
+		for j := 0; j < windowSize; j++ {
+			c.montMul(acc, acc, acc, t)
+		}
+		w := (e[i/bits.UintSize] >> uint(i%bits.UintSize)) & (1<<windowSize - 1)
+		for k := range entry {
+			entry[k] = 0
+		}
+		for k := range table {
+			mask := -ctEq(uint(k), w)
+			for j := range entry {
+				entry[j] |= table[k][j] & mask
+			}
+		}
+		c.montMul(acc, acc, entry, t)
+	}
+	return acc
+}
+
+// x^e mod m, processing as many exponent bits as words in the modulus so that the time doesn't depend on e
+func (c *montContext) expSecret(x *big.Int, e *big.Int) *big.Int {
+	n := len(c.m)
+	if len(e.Bits()) > n {
+		n = len(e.Bits())
+	}
+	//x on at least as many words as m so that its size doesn't show
+	xn := len(c.m)
+	if len(x.Bits()) > xn {
+		xn = len(x.Bits())
+	}
+	xm := c.toMont(toWords(x, xn))
+	return fromWords(c.fromMont(c.expMont(xm, toWords(e, n), n*bits.UintSize)))
+}
+
+// PowModuloMontgomery returns b^e mod m using Montgomery multiplication and a fixed window exponentiation
+// which doesn't depend on the value of e. m should be odd, b and e are not modified
+func PowModuloMontgomery(b *big.Int, e *big.Int, m *big.Int) *big.Int {
+	if m.Bit(0) == 0 {
+		return big.NewInt(0).Exp(b, e, m)
+	}
+	return newMontContext(m).expSecret(b, e)
+}
+
+// the CRT result of a private key operation doesn't match the public exponent
+var errFault = errors.New("private key operation failed: the result doesn't match the public key, computation fault")
+
+// precomputed Montgomery contexts of a private key
+type privateContext struct {
+	n *montContext
+	//CRT for two primes keys, nil otherwise
+	p, q   *montContext
+	dp, dq []uint
+	qinv   []uint
+	qWords []uint
+	//checks the CRT results, nil if e is unknown
+	public *PublicKey
+}
+
+func newPrivateContext(k *PrivateKey) *privateContext {
+	ctx := &privateContext{n: newMontContext(k.nn)}
+	primes, precomputed := k.primes, k.precomputed
+	if primes == nil && k.ee != nil {
+		//keys saved without their primes, they can be recovered knowing e
+		recovered := &PrivateKey{nn: k.nn, dd: k.dd, ee: k.ee}
+		var err error
+		if recovered.primes, err = recoverPrimes(k.nn, k.ee, k.dd); err == nil && recovered.precompute() == nil {
+			primes, precomputed = recovered.primes, recovered.precomputed
+		}
+	}
+	if precomputed == nil || len(primes) != 2 {
+		return ctx
+	}
+	p, q := primes[0], primes[1]
+	ctx.p = newMontContext(p)
+	ctx.q = newMontContext(q)
+	ctx.dp = toWords(precomputed.dp, len(ctx.p.m))
+	ctx.dq = toWords(precomputed.dq, len(ctx.q.m))
+	ctx.qinv = toWords(precomputed.qinv, len(ctx.p.m))
+	ctx.qWords = toWords(q, len(ctx.q.m))
+	if k.ee != nil {
+		ctx.public = &PublicKey{nn: k.nn, ee: k.ee}
+	}
+	return ctx
+}
+
+// c^d mod n, using the CRT when the primes are known. A fault in one of the two CRT exponentiations would give a
+// result revealing a prime factor of n: the result is checked with e when it is known, errFault on mismatch
+func (ctx *privateContext) exp(c *big.Int, dd *big.Int) (*big.Int, error) {
+	if ctx.p == nil {
+		return ctx.n.expSecret(c, dd), nil
+	}
+	cw := toWords(c, len(ctx.n.m))
+	p, q := ctx.p, ctx.q
+	//m1 = c^dp mod p, m2 = c^dq mod q
+	m1 := p.expMont(p.toMont(cw), ctx.dp, len(ctx.dp)*bits.UintSize)
+	m2 := q.fromMont(q.expMont(q.toMont(cw), ctx.dq, len(ctx.dq)*bits.UintSize))
+	//h = (m1 - m2) * qinv mod p, in Montgomery form (m1 - m2)*R * qinv / R
+	h := make([]uint, len(p.m))
+	p.modSub(h, m1, p.toMont(m2))
+	p.montMul(h, h, ctx.qinv, make([]uint, len(p.m)+2))
+	//m = m2 + h*q
+	m := make([]uint, len(h)+len(ctx.qWords)+1)
+	for i, hw := range h {
+		var carry uint
+		for j, qw := range ctx.qWords {
+			carry, m[i+j] = mulAddWWW(hw, qw, m[i+j], carry)
+		}
+		m[i+len(ctx.qWords)] = carry
+	}
+	var carry uint
+	for i := range m {
+		var mw uint
+		if i < len(m2) {
+			mw = m2[i]
+		}
+		m[i], carry = bits.Add(m[i], mw, carry)
+	}
+	result := fromWords(m)
+	if ctx.public != nil && ctx.public.encrypt(result).Cmp(big.NewInt(0).Mod(c, ctx.public.nn)) != 0 {
+		return nil, errFault
+	}
+	return result, nil
+}
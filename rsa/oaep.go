@@ -0,0 +1,94 @@
+package rsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+//RSAES-OAEP (RFC 8017 section 7.1)
+
+func (k *PublicKey) EncryptOAEP(hash crypto.Hash, msg []byte, label []byte) ([]byte, error) {
+	return k.encryptOAEP(hash, hash, msg, label)
+}
+
+func (k *PrivateKey) DecryptOAEP(hash crypto.Hash, ciphertext []byte, label []byte) ([]byte, error) {
+	return k.decryptOAEP(hash, hash, ciphertext, label)
+}
+
+// MaxOAEPMessageSize returns the largest message EncryptOAEP accepts with this key and hash
+func (k *PublicKey) MaxOAEPMessageSize(hash crypto.Hash) int {
+	return k.size() - 2*hash.Size() - 2
+}
+
+func (k *PublicKey) encryptOAEP(hash crypto.Hash, mgfHash crypto.Hash, msg []byte, label []byte) ([]byte, error) {
+	if !hash.Available() || !mgfHash.Available() {
+		return nil, fmt.Errorf("unsupported hash function: %v", hash)
+	}
+	size := k.size()
+	hLen := hash.Size()
+	if len(msg) > size-2*hLen-2 {
+		return nil, fmt.Errorf("message too long. It can't exceed %d bytes for this key", size-2*hLen-2)
+	}
+	//EM = 0x00 || maskedSeed || maskedDB, DB = lHash || PS || 0x01 || M
+	em := make([]byte, size)
+	seed := em[1 : 1+hLen]
+	db := em[1+hLen:]
+	h := hash.New()
+	h.Write(label)
+	h.Sum(db[:0])
+	db[len(db)-len(msg)-1] = 1
+	copy(db[len(db)-len(msg):], msg)
+	if _, err := io.ReadFull(rand.Reader, seed); err != nil {
+		return nil, err
+	}
+	mgf := mgfHash.New()
+	mgf1XOR(db, mgf, seed)
+	mgf1XOR(seed, mgf, db)
+	m := big.NewInt(0).SetBytes(em)
+	return leftPad(k.encrypt(m).Bytes(), size), nil
+}
+
+func (k *PrivateKey) decryptOAEP(hash crypto.Hash, mgfHash crypto.Hash, ciphertext []byte, label []byte) ([]byte, error) {
+	if !hash.Available() || !mgfHash.Available() {
+		return nil, fmt.Errorf("unsupported hash function: %v", hash)
+	}
+	size := k.size()
+	hLen := hash.Size()
+	if len(ciphertext) != size || size < 2*hLen+2 {
+		return nil, ErrDecryption
+	}
+	em, err := k.decryptBlock(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(label)
+	lHash := h.Sum(nil)
+	firstByteIsZero := subtle.ConstantTimeByteEq(em[0], 0)
+	seed := em[1 : 1+hLen]
+	db := em[1+hLen:]
+	mgf := mgfHash.New()
+	mgf1XOR(seed, mgf, db)
+	mgf1XOR(db, mgf, seed)
+	lHashGood := subtle.ConstantTimeCompare(db[:hLen], lHash)
+	//look for the 0x01 separator after PS without leaking its position
+	lookingForIndex := 1
+	index := 0
+	invalid := 0
+	rest := db[hLen:]
+	for i := 0; i < len(rest); i++ {
+		equals0 := subtle.ConstantTimeByteEq(rest[i], 0)
+		equals1 := subtle.ConstantTimeByteEq(rest[i], 1)
+		index = subtle.ConstantTimeSelect(lookingForIndex&equals1, i, index)
+		lookingForIndex = subtle.ConstantTimeSelect(equals1, 0, lookingForIndex)
+		invalid = subtle.ConstantTimeSelect(lookingForIndex&^equals0, 1, invalid)
+	}
+	if firstByteIsZero&lHashGood&^invalid&^lookingForIndex != 1 {
+		return nil, ErrDecryption
+	}
+	return rest[index+1:], nil
+}
@@ -0,0 +1,253 @@
+package rsa
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// a block to encrypt or decrypt, it owns its data so that it can run on any goroutine
+type blockTask func() ([]byte, error)
+
+// pipeline runs the tasks on workers goroutines and returns their results in the submission order.
+// At most 2*workers tasks are queued, submit blocks when the queue is full, so the memory used only
+// depends on the number of workers
+type pipeline struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	tasks  chan *pipelineTask
+	queue  chan *pipelineTask
+	mutex  sync.Mutex
+	err    error
+}
+
+type pipelineTask struct {
+	run  blockTask
+	data []byte
+	err  error
+	done chan struct{}
+}
+
+func newPipeline(ctx context.Context, workers int) *pipeline {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &pipeline{
+		ctx:    ctx,
+		cancel: cancel,
+		tasks:  make(chan *pipelineTask),
+		queue:  make(chan *pipelineTask, 2*workers),
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *pipeline) work() {
+	for {
+		select {
+		case t, ok := <-p.tasks:
+			if !ok {
+				return
+			}
+			t.data, t.err = t.run()
+			close(t.done)
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// queues the task, fails if the pipeline is stopped. submit and close are called by a single goroutine
+func (p *pipeline) submit(run blockTask) error {
+	t := &pipelineTask{run: run, done: make(chan struct{})}
+	select {
+	case p.queue <- t:
+	case <-p.ctx.Done():
+		return p.failure()
+	}
+	select {
+	case p.tasks <- t:
+	case <-p.ctx.Done():
+		return p.failure()
+	}
+	return nil
+}
+
+// no more task
+func (p *pipeline) close() {
+	close(p.tasks)
+	close(p.queue)
+}
+
+// returns the result of the next task, io.EOF after the last one. The first error stops the pipeline
+func (p *pipeline) next() ([]byte, error) {
+	select {
+	case t, ok := <-p.queue:
+		if !ok {
+			return nil, io.EOF
+		}
+		select {
+		case <-t.done:
+			if t.err != nil {
+				p.fail(t.err)
+				return nil, t.err
+			}
+			return t.data, nil
+		case <-p.ctx.Done():
+			return nil, p.failure()
+		}
+	case <-p.ctx.Done():
+		return nil, p.failure()
+	}
+}
+
+// stops the pipeline on err
+func (p *pipeline) fail(err error) {
+	p.mutex.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.mutex.Unlock()
+	p.cancel()
+}
+
+// the error which stopped the pipeline, the context error if it has been cancelled
+func (p *pipeline) failure() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	return p.ctx.Err()
+}
+
+// blockWriter writes the result of the tasks in order to w, running them on workers goroutines if workers > 1
+type blockWriter struct {
+	ctx      context.Context
+	w        io.Writer
+	pipe     *pipeline
+	done     chan error
+	closed   bool
+	progress *progress
+}
+
+func newBlockWriter(ctx context.Context, w io.Writer, workers int) *blockWriter {
+	b := &blockWriter{ctx: ctx, w: w}
+	if workers > 1 {
+		b.pipe = newPipeline(ctx, workers)
+		b.done = make(chan error, 1)
+		go b.writeResults()
+	}
+	return b
+}
+
+func (b *blockWriter) writeResults() {
+	for {
+		data, err := b.pipe.next()
+		if err == io.EOF {
+			b.done <- nil
+			return
+		}
+		if err == nil {
+			_, err = b.w.Write(data)
+		}
+		if err != nil {
+			b.pipe.fail(err)
+			b.done <- err
+			return
+		}
+		b.progress.block()
+	}
+}
+
+func (b *blockWriter) write(run blockTask) error {
+	if b.pipe != nil {
+		return b.pipe.submit(run)
+	}
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	data, err := run()
+	if err != nil {
+		return err
+	}
+	if _, err := b.w.Write(data); err != nil {
+		return err
+	}
+	b.progress.block()
+	return nil
+}
+
+// waits for the tasks written
+func (b *blockWriter) close() error {
+	if b.pipe == nil || b.closed {
+		return nil
+	}
+	b.closed = true
+	b.pipe.close()
+	err := <-b.done
+	b.pipe.cancel()
+	return err
+}
+
+// blockReader returns the result of the tasks of the decoder in order, running them on workers goroutines
+// if workers > 1. A goroutine then reads the source ahead, cancel ctx to stop it if the data are not read to the end
+type blockReader struct {
+	ctx      context.Context
+	decoder  bodyDecoder
+	pipe     *pipeline
+	progress *progress
+}
+
+func newBlockReader(ctx context.Context, decoder bodyDecoder, workers int) *blockReader {
+	b := &blockReader{ctx: ctx, decoder: decoder}
+	if workers > 1 {
+		b.pipe = newPipeline(ctx, workers)
+		go b.readTasks()
+	}
+	return b
+}
+
+func (b *blockReader) readTasks() {
+	defer b.pipe.close()
+	for {
+		run, err := b.decoder.next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			//the error is returned in order, after the blocks read before
+			b.pipe.submit(func() ([]byte, error) { return nil, err })
+			return
+		}
+		if b.pipe.submit(run) != nil {
+			return
+		}
+	}
+}
+
+func (b *blockReader) next() ([]byte, error) {
+	data, err := b.result()
+	if err == nil {
+		b.progress.blockRead()
+	}
+	return data, err
+}
+
+func (b *blockReader) result() ([]byte, error) {
+	if b.pipe != nil {
+		data, err := b.pipe.next()
+		if err != nil {
+			b.pipe.cancel()
+		}
+		return data, err
+	}
+	if err := b.ctx.Err(); err != nil {
+		return nil, err
+	}
+	run, err := b.decoder.next()
+	if err != nil {
+		return nil, err
+	}
+	return run()
+}
@@ -0,0 +1,216 @@
+package rsa
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+//RSAES-PKCS1-v1_5 (RFC 8017 section 7.2)
+
+var (
+	ErrDecryption   = errors.New("decryption error")
+	ErrVerification = errors.New("verification error")
+)
+
+func (k *PublicKey) EncryptPKCS1v15(msg []byte) ([]byte, error) {
+	size := k.size()
+	if len(msg) > size-11 {
+		return nil, fmt.Errorf("message too long. It can't exceed %d bytes for this key", size-11)
+	}
+	//EM = 0x00 || 0x02 || PS || 0x00 || M
+	em := make([]byte, size, size)
+	em[1] = 2
+	ps := em[2 : size-len(msg)-1]
+	if err := nonZeroRandomBytes(ps); err != nil {
+		return nil, err
+	}
+	copy(em[size-len(msg):], msg)
+	m := big.NewInt(0).SetBytes(em)
+	return leftPad(k.encrypt(m).Bytes(), size), nil
+}
+
+// DecryptPKCS1v15 returns ErrDecryption when the padding is wrong.
+// Don't use it where an attacker can observe the failures (Bleichenbacher), use DecryptPKCS1v15Implicit
+func (k *PrivateKey) DecryptPKCS1v15(ciphertext []byte) ([]byte, error) {
+	em, err := k.decryptBlock(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	valid, index := checkPKCS1v15Padding(em)
+	if valid == 0 {
+		return nil, ErrDecryption
+	}
+	return em[index:], nil
+}
+
+// DecryptPKCS1v15Implicit never reports a padding error, on wrong padding it returns a synthetic message
+// deterministically derived from the key and the ciphertext (draft-irtf-cfrg-rsa-guidance, implicit rejection)
+// so that a valid and an invalid ciphertext can't be distinguished, neither by the result nor by the timing.
+func (k *PrivateKey) DecryptPKCS1v15Implicit(ciphertext []byte) ([]byte, error) {
+	em, err := k.decryptBlock(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	size := len(em)
+	valid, index := checkPKCS1v15Padding(em)
+	synthetic, synthIndex := k.syntheticMessage(leftPad(ciphertext, size))
+	//both results have the same size, select in constant time
+	for i := range em {
+		em[i] = byte(subtle.ConstantTimeSelect(valid, int(em[i]), int(synthetic[i])))
+	}
+	index = subtle.ConstantTimeSelect(valid, index, synthIndex)
+	return em[index:], nil
+}
+
+func (k *PrivateKey) decryptBlock(ciphertext []byte) ([]byte, error) {
+	size := k.size()
+	if len(ciphertext) > size || size < 11 {
+		return nil, ErrDecryption
+	}
+	c := big.NewInt(0).SetBytes(ciphertext)
+	if c.Cmp(k.nn) >= 0 {
+		return nil, ErrDecryption
+	}
+	m, err := k.decrypt(c)
+	if err != nil {
+		return nil, err
+	}
+	return leftPad(m.Bytes(), size), nil
+}
+
+// returns valid=1 and the index of the message in em if padding is correct, without branching on em
+func checkPKCS1v15Padding(em []byte) (valid int, index int) {
+	firstByteIsZero := subtle.ConstantTimeByteEq(em[0], 0)
+	secondByteIsTwo := subtle.ConstantTimeByteEq(em[1], 2)
+	lookingForIndex := 1
+	for i := 2; i < len(em); i++ {
+		equals0 := subtle.ConstantTimeByteEq(em[i], 0)
+		index = subtle.ConstantTimeSelect(lookingForIndex&equals0, i, index)
+		lookingForIndex = subtle.ConstantTimeSelect(equals0, 0, lookingForIndex)
+	}
+	//PS should be at least 8 bytes long
+	validPS := subtle.ConstantTimeLessOrEq(2+8, index)
+	valid = firstByteIsZero & secondByteIsTwo & (^lookingForIndex & 1) & validPS
+	index = subtle.ConstantTimeSelect(valid, index+1, 0)
+	return valid, index
+}
+
+// returns a buffer of the modulus size having the synthetic message at its end, and the message index
+func (k *PrivateKey) syntheticMessage(ciphertext []byte) ([]byte, int) {
+	size := len(ciphertext)
+	dh := sha256.Sum256(leftPad(k.dd.Bytes(), size))
+	mac := hmac.New(sha256.New, dh[:])
+	mac.Write(ciphertext)
+	kdk := mac.Sum(nil)
+
+	candidates := implicitRejectionPRF(kdk, "length", 256)
+	maxLength := size - 2 - 8
+	mask := 1
+	for mask < maxLength {
+		mask = mask<<1 | 1
+	}
+	length := 0
+	for i := 0; i < len(candidates); i += 2 {
+		candidate := (int(candidates[i])<<8 | int(candidates[i+1])) & mask
+		length = subtle.ConstantTimeSelect(subtle.ConstantTimeLessOrEq(candidate, maxLength-1), candidate, length)
+	}
+	return implicitRejectionPRF(kdk, "message", size), size - length
+}
+
+func implicitRejectionPRF(kdk []byte, label string, length int) []byte {
+	ret := make([]byte, 0, length+sha256.Size)
+	mac := hmac.New(sha256.New, kdk)
+	bits := length * 8
+	for i := 0; len(ret) < length; i++ {
+		mac.Reset()
+		mac.Write([]byte{byte(i >> 8), byte(i)})
+		mac.Write([]byte(label))
+		mac.Write([]byte{byte(bits >> 8), byte(bits)})
+		ret = mac.Sum(ret)
+	}
+	return ret[:length]
+}
+
+func nonZeroRandomBytes(data []byte) error {
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		return err
+	}
+	for i := range data {
+		for data[i] == 0 {
+			if _, err := io.ReadFull(rand.Reader, data[i:i+1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//RSASSA-PKCS1-v1_5 (RFC 8017 section 8.2)
+
+// DER encoding of the DigestInfo prefix for each supported hash
+var hashPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+func (k *PrivateKey) SignPKCS1v15(hash crypto.Hash, hashed []byte) ([]byte, error) {
+	em, err := pkcs1v15SignatureEncoding(hash, hashed, k.size())
+	if err != nil {
+		return nil, err
+	}
+	s, err := k.decrypt(big.NewInt(0).SetBytes(em))
+	if err != nil {
+		return nil, err
+	}
+	return leftPad(s.Bytes(), len(em)), nil
+}
+
+func (k *PublicKey) VerifyPKCS1v15(hash crypto.Hash, hashed []byte, sig []byte) error {
+	size := k.size()
+	if len(sig) != size {
+		return ErrVerification
+	}
+	s := big.NewInt(0).SetBytes(sig)
+	if s.Cmp(k.nn) >= 0 {
+		return ErrVerification
+	}
+	expected, err := pkcs1v15SignatureEncoding(hash, hashed, size)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(leftPad(k.encrypt(s).Bytes(), size), expected) != 1 {
+		return ErrVerification
+	}
+	return nil
+}
+
+// EM = 0x00 || 0x01 || PS (0xff) || 0x00 || DigestInfo
+func pkcs1v15SignatureEncoding(hash crypto.Hash, hashed []byte, size int) ([]byte, error) {
+	prefix, ok := hashPrefixes[hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash function: %v", hash)
+	}
+	if len(hashed) != hash.Size() {
+		return nil, fmt.Errorf("hashed message should be %d bytes long for %v", hash.Size(), hash)
+	}
+	tLen := len(prefix) + len(hashed)
+	if size < tLen+11 {
+		return nil, fmt.Errorf("key too short for %v signatures", hash)
+	}
+	em := make([]byte, size, size)
+	em[1] = 1
+	for i := 2; i < size-tLen-1; i++ {
+		em[i] = 0xff
+	}
+	copy(em[size-tLen:], prefix)
+	copy(em[size-len(hashed):], hashed)
+	return em, nil
+}
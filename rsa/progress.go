@@ -0,0 +1,129 @@
+package rsa
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress is the state of an encryption or a decryption given to EncryptOptions.Progress and
+// DecryptOptions.Progress after each block
+type Progress struct {
+	//bytes of data encrypted or decrypted, before compression, and size of the data, -1 if unknown
+	Bytes int64
+	Total int64
+	//blocks encrypted or decrypted, chunks in hybrid mode
+	Blocks  int64
+	Elapsed time.Duration
+}
+
+// Throughput returns the bytes of data processed per second
+func (p Progress) Throughput() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Bytes) / p.Elapsed.Seconds()
+}
+
+// ETA returns the estimated time left, -1 if the size of the data is unknown or nothing has been processed yet
+func (p Progress) ETA() time.Duration {
+	throughput := p.Throughput()
+	if p.Total < 0 || throughput == 0 {
+		return -1
+	}
+	if p.Bytes >= p.Total {
+		return 0
+	}
+	return time.Duration(float64(p.Total-p.Bytes) / throughput * float64(time.Second))
+}
+
+// progress counts the data written or read by the caller and the blocks done by the pipeline, in order. The
+// encryption reports each block when it is written, which may be on the goroutine writing the blocks, the
+// decryption when the caller has read its data. The callback is never called concurrently. Methods of a nil
+// progress do nothing
+type progress struct {
+	callback func(Progress)
+	start    time.Time
+	total    int64
+	bytes    int64
+	blocks   int64
+	reported int64
+	mutex    sync.Mutex
+}
+
+func newProgress(callback func(Progress), total int64) *progress {
+	if callback == nil {
+		return nil
+	}
+	return &progress{callback: callback, start: time.Now(), total: total}
+}
+
+func (p *progress) add(n int) {
+	if p != nil {
+		atomic.AddInt64(&p.bytes, int64(n))
+	}
+}
+
+// counts a block written and reports it
+func (p *progress) block() {
+	if p != nil {
+		atomic.AddInt64(&p.blocks, 1)
+		p.report()
+	}
+}
+
+// counts a block decrypted, it is reported once read
+func (p *progress) blockRead() {
+	if p != nil {
+		atomic.AddInt64(&p.blocks, 1)
+	}
+}
+
+// calls the callback if blocks have been done since the last call
+func (p *progress) report() {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	blocks := atomic.LoadInt64(&p.blocks)
+	if blocks == p.reported {
+		return
+	}
+	p.reported = blocks
+	p.callback(Progress{Bytes: atomic.LoadInt64(&p.bytes), Total: p.total, Blocks: blocks, Elapsed: time.Since(p.start)})
+}
+
+// progressWriter counts the data written to the encrypt writer
+type progressWriter struct {
+	io.WriteCloser
+	progress *progress
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.progress.add(n)
+	return n, err
+}
+
+// progressReader counts the data read from the decrypt reader
+type progressReader struct {
+	r        io.Reader
+	progress *progress
+}
+
+// returns r counting the data read, r if progress is nil
+func progressReaderOf(r io.Reader, progress *progress) io.Reader {
+	if progress == nil {
+		return r
+	}
+	return &progressReader{r: r, progress: progress}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.progress.add(n)
+	r.progress.report()
+	return n, err
+}
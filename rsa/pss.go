@@ -0,0 +1,171 @@
+package rsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+)
+
+//RSASSA-PSS (RFC 8017 section 8.1) using MGF1 with the same hash as the message
+
+const (
+	//when signing, use the largest salt allowed by the key size. When verifying, accept any salt length
+	PSSSaltLengthAuto = 0
+	//use a salt having the hash size
+	PSSSaltLengthEqualsHash = -1
+)
+
+func (k *PrivateKey) SignPSS(hash crypto.Hash, hashed []byte, saltLength int) ([]byte, error) {
+	if err := checkHash(hash, hashed); err != nil {
+		return nil, err
+	}
+	emBits := k.nn.BitLen() - 1
+	emLen := (emBits + 7) / 8
+	switch saltLength {
+	case PSSSaltLengthAuto:
+		saltLength = emLen - hash.Size() - 2
+	case PSSSaltLengthEqualsHash:
+		saltLength = hash.Size()
+	}
+	if saltLength < 0 || emLen < hash.Size()+saltLength+2 {
+		return nil, fmt.Errorf("key too short for %v PSS signatures with a %d bytes salt", hash, saltLength)
+	}
+	salt := make([]byte, saltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	em := emsaPSSEncode(hashed, emBits, salt, hash.New())
+	s, err := k.decrypt(big.NewInt(0).SetBytes(em))
+	if err != nil {
+		return nil, err
+	}
+	return leftPad(s.Bytes(), k.size()), nil
+}
+
+func (k *PublicKey) VerifyPSS(hash crypto.Hash, hashed []byte, sig []byte, saltLength int) error {
+	if err := checkHash(hash, hashed); err != nil {
+		return err
+	}
+	if len(sig) != k.size() {
+		return ErrVerification
+	}
+	s := big.NewInt(0).SetBytes(sig)
+	if s.Cmp(k.nn) >= 0 {
+		return ErrVerification
+	}
+	emBits := k.nn.BitLen() - 1
+	emLen := (emBits + 7) / 8
+	m := k.encrypt(s)
+	if m.BitLen() > emBits {
+		return ErrVerification
+	}
+	if saltLength == PSSSaltLengthEqualsHash {
+		saltLength = hash.Size()
+	}
+	if saltLength < 0 {
+		return fmt.Errorf("invalid PSS salt length: %d", saltLength)
+	}
+	return emsaPSSVerify(hashed, leftPad(m.Bytes(), emLen), emBits, saltLength, hash.New())
+}
+
+func checkHash(hash crypto.Hash, hashed []byte) error {
+	if !hash.Available() {
+		return fmt.Errorf("unsupported hash function: %v", hash)
+	}
+	if len(hashed) != hash.Size() {
+		return fmt.Errorf("hashed message should be %d bytes long for %v", hash.Size(), hash)
+	}
+	return nil
+}
+
+func emsaPSSEncode(mHash []byte, emBits int, salt []byte, hash hash.Hash) []byte {
+	hLen := hash.Size()
+	emLen := (emBits + 7) / 8
+	//H = Hash(0x00*8 || mHash || salt)
+	hash.Write(make([]byte, 8))
+	hash.Write(mHash)
+	hash.Write(salt)
+	h := hash.Sum(nil)
+	//DB = PS || 0x01 || salt
+	em := make([]byte, emLen)
+	db := em[:emLen-hLen-1]
+	db[emLen-len(salt)-hLen-2] = 1
+	copy(db[emLen-len(salt)-hLen-1:], salt)
+	mgf1XOR(db, hash, h)
+	db[0] &= 0xff >> uint(8*emLen-emBits)
+	//EM = maskedDB || H || 0xbc
+	copy(em[emLen-hLen-1:], h)
+	em[emLen-1] = 0xbc
+	return em
+}
+
+func emsaPSSVerify(mHash []byte, em []byte, emBits int, saltLength int, hash hash.Hash) error {
+	hLen := hash.Size()
+	emLen := len(em)
+	if emLen < hLen+saltLength+2 || em[emLen-1] != 0xbc {
+		return ErrVerification
+	}
+	db := make([]byte, emLen-hLen-1)
+	copy(db, em[:emLen-hLen-1])
+	h := em[emLen-hLen-1 : emLen-1]
+	bitMask := byte(0xff >> uint(8*emLen-emBits))
+	if db[0] & ^bitMask != 0 {
+		return ErrVerification
+	}
+	mgf1XOR(db, hash, h)
+	db[0] &= bitMask
+	//PS should be zeros followed by 0x01, auto detect the salt length if needed
+	psLen := emLen - hLen - saltLength - 2
+	if saltLength == PSSSaltLengthAuto {
+		psLen = 0
+		for psLen < len(db) && db[psLen] == 0 {
+			psLen++
+		}
+		if psLen == len(db) {
+			return ErrVerification
+		}
+	}
+	for i := 0; i < psLen; i++ {
+		if db[i] != 0 {
+			return ErrVerification
+		}
+	}
+	if db[psLen] != 1 {
+		return ErrVerification
+	}
+	salt := db[psLen+1:]
+	hash.Reset()
+	hash.Write(make([]byte, 8))
+	hash.Write(mHash)
+	hash.Write(salt)
+	if subtle.ConstantTimeCompare(hash.Sum(nil), h) != 1 {
+		return ErrVerification
+	}
+	return nil
+}
+
+// xor data with MGF1(seed) (RFC 8017 appendix B.2.1)
+func mgf1XOR(data []byte, hash hash.Hash, seed []byte) {
+	counter := make([]byte, 4)
+	done := 0
+	for done < len(data) {
+		hash.Reset()
+		hash.Write(seed)
+		hash.Write(counter)
+		mask := hash.Sum(nil)
+		for i := 0; i < len(mask) && done < len(data); i++ {
+			data[done] ^= mask[i]
+			done++
+		}
+		for i := 3; i >= 0; i-- {
+			counter[i]++
+			if counter[i] != 0 {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package rsa
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DecryptRange decrypts length bytes of the original file from offset, to the end of the file if length is
+// negative. Only the segments of blocks covering the range are read and decrypted, their data are verified with
+// the block tree of the file: it needs a rsa mode file of known size, written without compression
+func DecryptRange(sourcePath string, targetPath string, keyPath string, offset int64, length int64) error {
+	return DecryptRangeContext(context.Background(), sourcePath, targetPath, keyPath, offset, length, nil)
+}
+
+// DecryptRangeContext stops with the error of ctx when it is cancelled, targetPath is written atomically
+func DecryptRangeContext(ctx context.Context, sourcePath string, targetPath string, keyPath string, offset int64, length int64, options *DecryptOptions) error {
+	filei, errf := os.Open(sourcePath)
+	if errf != nil {
+		return errf
+	}
+	defer filei.Close()
+	return writeFileAtomic(targetPath, func(w io.Writer) error {
+		return DecryptRangeStream(ctx, filei, w, keyPath, offset, length, options)
+	})
+}
+
+// DecryptRangeStream decrypts a range of source into target, each segment of blocks is verified before its
+// data are written
+func DecryptRangeStream(ctx context.Context, source io.ReaderAt, target io.Writer, keyPath string, offset int64, length int64, options *DecryptOptions) error {
+	privateKey, errp := GetPrivateKey(keyPath)
+	if errp != nil {
+		return errp
+	}
+	if options == nil {
+		options = &DecryptOptions{}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	decoder, err := newRangeDecoder(ctx, source, privateKey, offset, length, options.Workers)
+	if err != nil {
+		return err
+	}
+	progress := newProgress(options.Progress, decoder.length)
+	blocks := newBlockReader(ctx, decoder, options.Workers)
+	blocks.progress = progress
+	_, err = io.Copy(target, progressReaderOf(&decryptReader{blocks: blocks}, progress))
+	return err
+}
+
+// rangeDecoder reads and decrypts the segments of blocks covering a range, checks their data with the tree and
+// returns the tasks returning the data of the range
+type rangeDecoder struct {
+	ctx        context.Context
+	r          io.ReaderAt
+	privateKey *PrivateKey
+	//goroutines decrypting the blocks of a segment
+	workers  int
+	mode     string
+	size     int
+	dataSize int
+	//offset of the first block in the file, number of blocks and size of the data in the last one
+	body  int64
+	count int64
+	lastN int
+	tree  *treeReader
+	//blocks by leaf, leaf read and the data of its blocks, verified
+	segment  int64
+	leaf     int64
+	leafData [][]byte
+	//next block, first and last blocks of the range
+	block     int64
+	first     int64
+	lastBlock int64
+	//range in the data of the first and of the last block
+	start int
+	end   int
+	//data decrypted not read yet by Read
+	pending []byte
+	//length of the range
+	length int64
+}
+
+func newRangeDecoder(ctx context.Context, r io.ReaderAt, privateKey *PrivateKey, offset int64, length int64, workers int) (*rangeDecoder, error) {
+	d, header, err := openBlockTree(ctx, r, privateKey, workers)
+	if err != nil {
+		return nil, err
+	}
+	if header.Content == contentArchive {
+		return nil, fmt.Errorf("the file is a directory archive, use decryptDir")
+	}
+	//the data of the file follow its metadata
+	dataOffset, dataLength := int64(0), header.Length
+	if header.Content == contentFile {
+		d.setRange(0, header.Length)
+		metadata, err := readMetadata(d)
+		if err != nil {
+			return nil, err
+		}
+		if metadata.Size < 0 || metadata.Size > header.Length-4 {
+			return nil, fmt.Errorf("corrupted file metadata: invalid size %d", metadata.Size)
+		}
+		dataLength = metadata.Size
+		dataOffset = header.Length - dataLength
+	}
+	if offset < 0 || offset > dataLength {
+		return nil, fmt.Errorf("offset %d out of the file (%d bytes)", offset, dataLength)
+	}
+	if length < 0 || offset+length > dataLength {
+		length = dataLength - offset
+	}
+	d.setRange(dataOffset+offset, length)
+	return d, nil
+}
+
+// reads the header and checks the root of the block tree, no range is selected
+func openBlockTree(ctx context.Context, r io.ReaderAt, privateKey *PrivateKey, workers int) (*rangeDecoder, *fileHeader, error) {
+	section := io.NewSectionReader(r, 0, maxHeaderSize+int64(len(fileMagic))+5)
+	header, err := readHeader(section)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Mode == ModeHybrid || header.Tree == "" {
+		return nil, nil, fmt.Errorf("the file has no block tree, a range can't be decrypted: it must be a %s or %s mode file of known size, without compression", ModeRSA, ModeOAEP)
+	}
+	if err := header.checkKey(privateKey); err != nil {
+		return nil, nil, err
+	}
+	macKey, err := privateKey.Decapsulate(header.MACKey)
+	if err != nil {
+		return nil, nil, ErrAuthentication
+	}
+	raw, err := header.marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	body, _ := section.Seek(0, io.SeekCurrent)
+	size, dataSize := rsaBlockSizes(header.Mode, privateKey.nn)
+	count := treeBlocks(header.Length, dataSize)
+	d := &rangeDecoder{
+		ctx:        ctx,
+		r:          r,
+		privateKey: privateKey,
+		workers:    workers,
+		mode:       header.Mode,
+		size:       size,
+		dataSize:   dataSize,
+		body:       body,
+		count:      count,
+		lastN:      int(header.Length - (count-1)*int64(dataSize)),
+		segment:    int64(header.TreeSegment),
+		leaf:       -1,
+	}
+	treeOffset := body + count*int64(size) + rsaTrailerSize
+	if d.tree, err = newTreeReader(r, treeOffset, count, header.TreeSegment, macKey, raw); err != nil {
+		return nil, nil, err
+	}
+	return d, header, nil
+}
+
+// selects the blocks of length bytes of the data from offset, the range must be in the data
+func (d *rangeDecoder) setRange(offset int64, length int64) {
+	dataSize := int64(d.dataSize)
+	d.block, d.first = offset/dataSize, offset/dataSize
+	d.lastBlock = (offset + length - 1) / dataSize
+	d.start, d.end = int(offset%dataSize), int((offset+length-1)%dataSize)+1
+	d.length = length
+	if length == 0 {
+		d.lastBlock = d.block - 1
+	}
+	d.pending = nil
+}
+
+// reads the range synchronously, used to read the metadata before the data
+func (d *rangeDecoder) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		task, err := d.next()
+		if err != nil {
+			return 0, err
+		}
+		if d.pending, err = task(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+func (d *rangeDecoder) next() (blockTask, error) {
+	if d.block > d.lastBlock {
+		return nil, io.EOF
+	}
+	index := d.block
+	if leaf := index / d.segment; leaf != d.leaf {
+		if err := d.readLeaf(leaf); err != nil {
+			return nil, err
+		}
+	}
+	data := d.leafData[index-d.leaf*d.segment]
+	start, end := 0, d.dataSize
+	if index == d.lastBlock {
+		end = d.end
+	}
+	if index == d.first {
+		start = d.start
+	}
+	d.block++
+	return func() ([]byte, error) {
+		if len(data) < end {
+			return nil, fmt.Errorf("corrupted data: invalid block size %d", len(data))
+		}
+		return data[start:end], nil
+	}, nil
+}
+
+// reads and decrypts the blocks of a leaf and checks their data with the tree
+func (d *rangeDecoder) readLeaf(leaf int64) error {
+	blocks := d.segment
+	if rest := d.count - leaf*d.segment; rest < blocks {
+		blocks = rest
+	}
+	data := make([]byte, blocks*int64(d.size))
+	if _, err := d.r.ReadAt(data, d.body+leaf*d.segment*int64(d.size)); err != nil {
+		if err == io.EOF {
+			return ErrAuthentication
+		}
+		return err
+	}
+	decrypted := newBlockReader(d.ctx, &leafDecoder{d: d, data: data, index: leaf * d.segment}, d.workers)
+	leafData := make([][]byte, 0, blocks)
+	for {
+		block, err := decrypted.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		leafData = append(leafData, block)
+	}
+	if err := d.tree.verify(leaf, leafData); err != nil {
+		return err
+	}
+	d.leaf, d.leafData = leaf, leafData
+	return nil
+}
+
+// decrypts the block index, the tag of the tree has been checked with the key: a block which can't be decrypted
+// has been modified
+func (d *rangeDecoder) decrypt(index int64, block []byte) ([]byte, error) {
+	var data []byte
+	var err error
+	if d.mode == ModeOAEP {
+		data, err = d.privateKey.DecryptOAEP(oaepBlockHash, block, nil)
+	} else {
+		data, err = d.privateKey.DecryptRaw(block, d.dataSize)
+	}
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	//the data of the last block are at the end of the decrypted block
+	if index == d.count-1 {
+		if len(data) < d.lastN {
+			return nil, ErrAuthentication
+		}
+		data = data[len(data)-d.lastN:]
+	}
+	return data, nil
+}
+
+// leafDecoder returns the tasks decrypting the blocks of a leaf
+type leafDecoder struct {
+	d     *rangeDecoder
+	data  []byte
+	index int64
+}
+
+func (l *leafDecoder) next() (blockTask, error) {
+	if len(l.data) == 0 {
+		return nil, io.EOF
+	}
+	block, index := l.data[:l.d.size], l.index
+	l.data, l.index = l.data[l.d.size:], l.index+1
+	return func() ([]byte, error) {
+		return l.d.decrypt(index, block)
+	}, nil
+}
@@ -0,0 +1,176 @@
+package rsa
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+var fileKeyLabel = []byte("cipher file key")
+
+// Fingerprint identifies the key in the recipient table of the files: sha256 of its hexadecimal form (n-e)
+func (k *PublicKey) Fingerprint() string {
+	sum := sha256.Sum256([]byte(k.ToHexa()))
+	return hex.EncodeToString(sum[:])
+}
+
+// fingerprint of the public key, empty if e is unknown
+func (k *PrivateKey) fingerprint() string {
+	if k.ee == nil {
+		return ""
+	}
+	return (&PublicKey{nn: k.nn, ee: k.ee}).Fingerprint()
+}
+
+func wrapFileKey(publicKey *PublicKey, fileKey []byte) (recipient, error) {
+	if publicKey.MaxOAEPMessageSize(crypto.SHA256) < len(fileKey) {
+		return recipient{}, fmt.Errorf("key too small for the hybrid mode (%d bits)", publicKey.nn.BitLen())
+	}
+	wrappedKey, err := publicKey.EncryptOAEP(crypto.SHA256, fileKey, fileKeyLabel)
+	if err != nil {
+		return recipient{}, err
+	}
+	return recipient{Fingerprint: publicKey.Fingerprint(), WrappedKey: wrappedKey}, nil
+}
+
+// finds the entry of the private key in the recipient table, all entries are tried for keys without e
+func (h *fileHeader) unwrapFileKey(privateKey *PrivateKey) ([]byte, error) {
+	fingerprint := privateKey.fingerprint()
+	for _, entry := range h.Recipients {
+		if fingerprint != "" && entry.Fingerprint != fingerprint {
+			continue
+		}
+		if fileKey, err := privateKey.DecryptOAEP(crypto.SHA256, entry.WrappedKey, fileKeyLabel); err == nil {
+			return fileKey, nil
+		}
+	}
+	if fingerprint == "" {
+		return nil, fmt.Errorf("the file is not encrypted for this key")
+	}
+	return nil, fmt.Errorf("the file is not encrypted for this key (fingerprint %s)", fingerprint)
+}
+
+// AddRecipients lets the owners of the public keys decrypt a hybrid file. The file key is decrypted with
+// the private key of a recipient, the body is not encrypted again
+func AddRecipients(path string, privateKeyPath string, publicKeyPaths ...string) error {
+	privateKey, err := GetPrivateKey(privateKeyPath)
+	if err != nil {
+		return err
+	}
+	publicKeys, err := getPublicKeys(publicKeyPaths)
+	if err != nil {
+		return err
+	}
+	return rewriteHeader(path, func(header *fileHeader) error {
+		fileKey, err := header.unwrapFileKey(privateKey)
+		if err != nil {
+			return err
+		}
+		for _, publicKey := range publicKeys {
+			if header.hasRecipient(publicKey.Fingerprint()) {
+				continue
+			}
+			entry, err := wrapFileKey(publicKey, fileKey)
+			if err != nil {
+				return err
+			}
+			header.Recipients = append(header.Recipients, entry)
+		}
+		return nil
+	})
+}
+
+// RemoveRecipients removes recipients given by their public key path or fingerprint from a hybrid file.
+// The file key doesn't change, a removed recipient who saved it can still decrypt the body
+func RemoveRecipients(path string, recipients ...string) error {
+	fingerprints := map[string]bool{}
+	for _, name := range recipients {
+		if publicKey, err := GetPublicKey(name); err == nil {
+			fingerprints[publicKey.Fingerprint()] = true
+		} else if _, errs := os.Stat(name); errs == nil {
+			return err
+		} else {
+			fingerprints[name] = true
+		}
+	}
+	return rewriteHeader(path, func(header *fileHeader) error {
+		kept := []recipient{}
+		for _, entry := range header.Recipients {
+			if !fingerprints[entry.Fingerprint] {
+				kept = append(kept, entry)
+			}
+		}
+		if len(kept) == len(header.Recipients) {
+			return fmt.Errorf("no recipient to remove")
+		}
+		if len(kept) == 0 {
+			return fmt.Errorf("can't remove all the recipients")
+		}
+		header.Recipients = kept
+		return nil
+	})
+}
+
+func (h *fileHeader) hasRecipient(fingerprint string) bool {
+	for _, entry := range h.Recipients {
+		if entry.Fingerprint == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// updates the header of a hybrid file, the body is copied as is in a temporary file renamed over the file with
+// its permissions. An armored file is written with the same armor headers
+func rewriteHeader(path string, update func(*fileHeader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	br := bufio.NewReader(file)
+	var r io.Reader = br
+	var armorHeaders map[string]string
+	if isArmored(br) {
+		if r, armorHeaders, err = NewArmorReader(br); err != nil {
+			return err
+		}
+	}
+	header, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+	if header.Mode != ModeHybrid {
+		return fmt.Errorf("recipients can only be changed in hybrid mode files")
+	}
+	if err := update(header); err != nil {
+		return err
+	}
+	raw, err := header.marshal()
+	if err != nil {
+		return err
+	}
+	return replaceFileAtomic(path, func(w io.Writer) error {
+		var armor io.WriteCloser
+		if armorHeaders != nil {
+			if armor, err = NewArmorWriter(w, armorHeaders); err != nil {
+				return err
+			}
+			w = armor
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return err
+		}
+		if armor != nil {
+			return armor.Close()
+		}
+		return nil
+	})
+}
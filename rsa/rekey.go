@@ -0,0 +1,176 @@
+package rsa
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// EncryptedFile is a file found by FilesOnKey, Err is set if the file can't be read or its header is invalid
+type EncryptedFile struct {
+	Path string
+	Mode string
+	Err  error
+}
+
+// RekeyFile encrypts the file at path for the public key toKeyPath instead of the private key fromKeyPath.
+// In hybrid mode only the header is rewritten: the file key is wrapped for the new key and the entry of the old
+// key removed, the other recipients are kept. In rsa and rsa-oaep modes the decryption is streamed into the
+// encryption in memory, the plaintext is never written. The file is replaced atomically, with its permissions,
+// once the whole file is authenticated
+func RekeyFile(path string, fromKeyPath string, toKeyPath string, options *DecryptOptions) error {
+	return RekeyFileContext(context.Background(), path, fromKeyPath, toKeyPath, options)
+}
+
+// RekeyFileContext stops with the error of ctx when it is cancelled, the file is left unchanged
+func RekeyFileContext(ctx context.Context, path string, fromKeyPath string, toKeyPath string, options *DecryptOptions) error {
+	if options == nil {
+		options = &DecryptOptions{}
+	}
+	privateKey, err := GetPrivateKey(fromKeyPath)
+	if err != nil {
+		return err
+	}
+	publicKey, err := GetPublicKey(toKeyPath)
+	if err != nil {
+		return err
+	}
+	if privateKey.fingerprint() == publicKey.Fingerprint() {
+		return fmt.Errorf("the new key is the old key")
+	}
+	header, err := readFileHeader(path)
+	if err != nil {
+		return err
+	}
+	if header != nil && header.Mode == ModeHybrid {
+		return rewriteHeader(path, func(header *fileHeader) error {
+			fileKey, err := header.unwrapFileKey(privateKey)
+			if err != nil {
+				return err
+			}
+			kept := []recipient{}
+			for _, entry := range header.Recipients {
+				if !privateKey.wrapped(entry) && entry.Fingerprint != publicKey.Fingerprint() {
+					kept = append(kept, entry)
+				}
+			}
+			entry, err := wrapFileKey(publicKey, fileKey)
+			if err != nil {
+				return err
+			}
+			header.Recipients = append(kept, entry)
+			return nil
+		})
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return replaceFileAtomic(path, func(w io.Writer) error {
+		return rekeyStream(ctx, file, w, privateKey, publicKey, options)
+	})
+}
+
+// decrypts source with the private key into an encryption for the public key with the same mode, compression,
+// content and armor
+func rekeyStream(ctx context.Context, source io.Reader, target io.Writer, privateKey *PrivateKey, publicKey *PublicKey, options *DecryptOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	br := bufio.NewReader(source)
+	armored := isArmored(br)
+	r, header, err := newDecryptReader(ctx, br, privateKey, options)
+	if err != nil {
+		return err
+	}
+	encryptOptions := &EncryptOptions{Mode: header.Mode, Workers: options.Workers, Compression: header.Compression, Armor: armored}
+	w, err := newEncryptWriter(ctx, target, []*PublicKey{publicKey}, encryptOptions, fileHeader{Length: header.Length, Content: header.Content})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// tells if the recipient entry is the file key wrapped for the private key, the key is tried for keys without e
+func (k *PrivateKey) wrapped(entry recipient) bool {
+	if fingerprint := k.fingerprint(); fingerprint != "" {
+		return entry.Fingerprint == fingerprint
+	}
+	_, err := (&fileHeader{Recipients: []recipient{entry}}).unwrapFileKey(k)
+	return err == nil
+}
+
+// FilesOnKey returns the encrypted files of the directory tree at path, or the file at path, which are
+// encrypted for the private key keyPath. Only the headers are read, the files written by the previous
+// versions without header can't be recognized and are not returned. The files and directories which can't be
+// read, and the files with an invalid header, are returned with their error and the walk goes on
+func FilesOnKey(path string, keyPath string) ([]EncryptedFile, error) {
+	privateKey, err := GetPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	files := []EncryptedFile{}
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if file == path {
+				return err
+			}
+			files = append(files, EncryptedFile{Path: file, Err: err})
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		header, err := readFileHeader(file)
+		if err != nil {
+			files = append(files, EncryptedFile{Path: file, Err: err})
+			return nil
+		}
+		if header != nil && header.onKey(privateKey) {
+			files = append(files, EncryptedFile{Path: file, Mode: header.Mode})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// tells if the file can be decrypted with the private key
+func (h *fileHeader) onKey(privateKey *PrivateKey) bool {
+	if h.Mode != ModeHybrid {
+		return h.checkKey(privateKey) == nil
+	}
+	for _, entry := range h.Recipients {
+		if privateKey.wrapped(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// reads the header of an encrypted file, armored or not, nil if the file doesn't start as a cipher file
+func readFileHeader(path string) (*fileHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	br := bufio.NewReader(file)
+	if isArmored(br) {
+		armor, _, err := NewArmorReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(armor)
+	}
+	if magic, _ := br.Peek(len(fileMagic)); string(magic) != fileMagic {
+		return nil, nil
+	}
+	return readHeader(br)
+}
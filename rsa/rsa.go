@@ -2,26 +2,52 @@ package rsa
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"math/big"
-	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type PublicKey struct {
 	nn *big.Int
 	ee *big.Int
+	//exponentiation of the public key operations, see SetExpAlgorithm
+	exp ExpAlgorithm
 }
 
 type PrivateKey struct {
 	nn *big.Int
 	dd *big.Int
+	//public exponent, nil for keys saved by older versions without it
+	ee *big.Int
+	//prime factors of n and their CRT values, nil for keys saved by older versions without them
+	primes      []*big.Int
+	precomputed *precomputedValues
+	//Montgomery contexts, computed on first use
+	ctxOnce sync.Once
+	ctx     *privateContext
+	//ciphertext blinding is disabled, see SetBlinding. Atomic: the key can be used by several goroutines
+	noBlinding atomic.Bool
 }
 
 func CreateRSAKey(keyBitSize int, verbose bool, debug bool) (*PublicKey, *PrivateKey, error) {
+	return createRSAKey(keyBitSize, nil, verbose, debug)
+}
+
+// CreateRSAKeyWithExponent uses the public exponent e instead of a random one.
+// With e=65537 the keys are accepted by crypto/rsa, crypto/tls and crypto/x509
+func CreateRSAKeyWithExponent(keyBitSize int, e int, verbose bool, debug bool) (*PublicKey, *PrivateKey, error) {
+	if e < 3 || e%2 == 0 {
+		return nil, nil, fmt.Errorf("public exponent should be an odd number greater than 2")
+	}
+	return createRSAKey(keyBitSize, big.NewInt(int64(e)), verbose, debug)
+}
+
+func createRSAKey(keyBitSize int, fixedE *big.Int, verbose bool, debug bool) (*PublicKey, *PrivateKey, error) {
 	if keyBitSize%64 != 0 {
 		return nil, nil, fmt.Errorf("number of bits should be a multiple of 64")
 	}
@@ -30,43 +56,20 @@ func CreateRSAKey(keyBitSize int, verbose bool, debug bool) (*PublicKey, *Privat
 		fmt.Printf("Compute RSA keys size: %d bits\n", pSize*2)
 	}
 
-	//find two random prime size sqrt(keyBitsize)
-	p1 := big.NewInt(0)
-	p2 := big.NewInt(0)
-	found := 0
-
-	go func() {
-		for p1.BitLen() != pSize {
-			p1 = GetRandomPrime(pSize, verbose, debug)
-			if p1.BitLen() == pSize {
-				found++
-				if verbose {
-					fmt.Printf("prime (%dbits): %s\n", p1.BitLen(), p1)
-				}
-			}
-			if verbose && p2.BitLen() != pSize {
-				fmt.Println("Bad one, recompute it")
-			}
+	var p1, p2 *big.Int
+	tmp := big.NewInt(0)
+	for {
+		p1, p2 = getKeyPrimes(pSize, verbose, debug)
+		if fixedE == nil {
+			break
 		}
-	}()
-
-	go func() {
-		for p2.BitLen() != pSize {
-			p2 = GetRandomPrime(pSize, verbose, debug)
-			if p2.BitLen() == pSize {
-				found++
-				if verbose {
-					fmt.Printf("prime (%dbits): %s\n", p2.BitLen(), p2)
-				}
-			}
-			if verbose && p2.BitLen() != pSize {
-				fmt.Println("Bad one, recompute it")
-			}
+		//a fixed e should be coprime with p1-1 and p2-1
+		if tmp.GCD(nil, nil, fixedE, tmp.Sub(p1, one)).Cmp(one) == 0 && tmp.GCD(nil, nil, fixedE, tmp.Sub(p2, one)).Cmp(one) == 0 {
+			break
+		}
+		if verbose {
+			fmt.Println("e is not coprime with phi, recompute primes")
 		}
-	}()
-
-	for found < 2 {
-		time.Sleep(1 * time.Second)
 	}
 
 	//Compute n
@@ -78,22 +81,24 @@ func CreateRSAKey(keyBitSize int, verbose bool, debug bool) (*PublicKey, *Privat
 
 	//compute phi
 	phi := big.NewInt(0)
-	phi.Mul(p1.Sub(p1, one), p2.Sub(p2, one))
+	phi.Mul(big.NewInt(0).Sub(p1, one), big.NewInt(0).Sub(p2, one))
 	if verbose {
 		fmt.Printf("phi=%s\n", phi)
 	}
 
 	//compute e
 	//ee := big.NewInt(13)
-	ee := GetRandom(keyBitSize / 4)
-	tmp := big.NewInt(0)
-	for {
-		ee = GetNextPrime(ee, verbose, false)
-		if verbose {
-			fmt.Printf("test e=%s\n", ee)
-		}
-		if tmp.Mod(phi, ee).Cmp(zero) != 0 {
-			break
+	ee := fixedE
+	if ee == nil {
+		ee = GetRandom(keyBitSize / 4)
+		for {
+			ee = GetNextPrime(ee, verbose, false)
+			if verbose {
+				fmt.Printf("test e=%s\n", ee)
+			}
+			if tmp.Mod(phi, ee).Cmp(zero) != 0 {
+				break
+			}
 		}
 	}
 	if verbose {
@@ -106,106 +111,39 @@ func CreateRSAKey(keyBitSize int, verbose bool, debug bool) (*PublicKey, *Privat
 	if verbose {
 		fmt.Printf("d=%s\n", dd)
 	}
-	return &PublicKey{nn: nn, ee: ee}, &PrivateKey{nn: nn, dd: dd}, nil
-}
-
-func EncryptFile(sourcePath string, targetPath string, keyPath string) error {
-	publicKey, errp := GetPublicKey(keyPath)
-	if errp != nil {
-		return errp
-	}
-	bufferSize := publicKey.nn.BitLen()/8 - 1
-	//fmt.Printf("key size: %d\n", bufferSize+1)
-	filei, errf := os.OpenFile(sourcePath, os.O_RDWR, 0666)
-	if errf != nil {
-		return errf
-	}
-	defer filei.Close()
-	fileo, errf := os.Create(targetPath)
-	if errf != nil {
-		return errf
-	}
-	defer fileo.Close()
-	data := make([]byte, bufferSize, bufferSize)
-	nn := 0
-	lastN := 0
-	for {
-		data = data[:cap(data)]
-		n, err := filei.Read(data)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-		data = data[:n]
-		//fmt.Printf("%d: read: (%d):%v\n\n", nn, len(data), data)
-		datac, _ := publicKey.Encrypt(data, bufferSize+1)
-		//fmt.Printf("%d: enc: (%d):%v\n", nn, len(datac), datac)
-		if _, err := fileo.Write(datac); err != nil {
-			return err
-		}
-		lastN = n
-		nn++
-	}
-	//fmt.Printf("end: %d\n", lastN)
-	if _, err := fileo.Write([]byte{byte(lastN % 256), byte(lastN / 256)}); err != nil {
-		return err
+	privateKey := &PrivateKey{nn: nn, dd: dd, ee: ee, primes: []*big.Int{p1, p2}}
+	if err := privateKey.precompute(); err != nil {
+		return nil, nil, err
 	}
-	return nil
+	return &PublicKey{nn: nn, ee: ee}, privateKey, nil
 }
 
-func DecryptFile(sourcePath string, targetPath string, keyPath string) error {
-	privateKey, errp := GetPrivateKey(keyPath)
-	if errp != nil {
-		return errp
-	}
-	bufferSize := privateKey.nn.BitLen()/8 - 1
-	//fmt.Printf("key size: %d\n", bufferSize+1)
-	filei, errf := os.OpenFile(sourcePath, os.O_RDWR, 0666)
-	if errf != nil {
-		return errf
-	}
-	defer filei.Close()
-	fileo, errf := os.Create(targetPath)
-	if errf != nil {
-		return errf
-	}
-	defer fileo.Close()
-	prevData := make([]byte, bufferSize+1, bufferSize+1)
-	data := make([]byte, bufferSize+1, bufferSize+1)
-	datac := make([]byte, 0, 0)
-	nn := 0
-	for {
-		data = data[:cap(data)]
-		n, err := filei.Read(data)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-		data = data[:n]
-		//fmt.Printf("%d: read: (%d):%v\n", nn, len(data), data)
-		if nn > 0 {
-			datac, _ = privateKey.Decrypt(prevData, bufferSize)
-			if len(data) == 2 {
-				slen := int(data[0]) + int(data[1])*256
-				datac = datac[bufferSize-slen:]
-				//fmt.Printf("%d: dec-end: (%d):%v\n\n", nn-1, len(datac), datac)
+// find two random primes of size bits in parallel
+func getKeyPrimes(pSize int, verbose bool, debug bool) (*big.Int, *big.Int) {
+	primes := make(chan *big.Int)
+	for i := 0; i < 2; i++ {
+		go func() {
+			p := big.NewInt(0)
+			for p.BitLen() != pSize {
+				p = getKeyPrime(pSize, verbose, debug)
+				if verbose && p.BitLen() != pSize {
+					fmt.Println("Bad one, recompute it")
+				}
 			}
-			//fmt.Printf("%d: write: (%d):%v\n\n", nn-1, len(datac), datac)
-			if _, err := fileo.Write(datac); err != nil {
-				return err
+			if verbose {
+				fmt.Printf("prime (%dbits): %s\n", p.BitLen(), p)
 			}
-		}
-		prevData = prevData[:n]
-		for i, val := range data {
-			prevData[i] = val
-		}
-		nn++
+			primes <- p
+		}()
 	}
-	return nil
+	return <-primes, <-primes
+}
+
+// prime having its two highest bits set, so that the product of two of them has exactly 2*size bits
+func getKeyPrime(size int, verbose bool, debug bool) *big.Int {
+	n := GetRandom(size)
+	n.SetBit(n, size-2, 1)
+	return GetNextPrime(n, verbose, debug)
 }
 
 func GetKeys(path string) (*PublicKey, *PrivateKey, error) {
@@ -217,6 +155,9 @@ func GetKeys(path string) (*PublicKey, *PrivateKey, error) {
 	if erri != nil {
 		return nil, nil, erri
 	}
+	if privateKey.ee == nil && privateKey.nn.Cmp(publicKey.nn) == 0 {
+		privateKey.ee = publicKey.ee
+	}
 	return publicKey, privateKey, nil
 }
 
@@ -235,7 +176,14 @@ func (k *PublicKey) ToHexa() string {
 }
 
 func (k *PrivateKey) ToHexa() string {
-	return fmt.Sprintf("%x-%x", k.nn, k.dd)
+	if k.ee == nil {
+		return fmt.Sprintf("%x-%x", k.nn, k.dd)
+	}
+	hexa := fmt.Sprintf("%x-%x-%x", k.nn, k.dd, k.ee)
+	for _, prime := range k.primes {
+		hexa += fmt.Sprintf("-%x", prime)
+	}
+	return hexa
 }
 
 func GetPublicKey(path string) (*PublicKey, error) {
@@ -269,55 +217,111 @@ func (k *PublicKey) Encrypt(data []byte, size int) ([]byte, error) {
 	//fmt.Printf("enc data=%d size=%d\n", len(data), size)
 	tmp := big.NewInt(0)
 	tmp.SetBytes(data)
-	ee := big.NewInt(0)
-	ee.Abs(k.ee)
-	nn := big.NewInt(0)
-	nn.Abs(k.nn)
-	tmp = PowModulo(tmp, ee, nn)
-	dec := tmp.Bytes()
-	if len(dec) < size {
-		dif := size - len(dec)
-		data := make([]byte, size, size)
-		for i, _ := range dec {
-			data[i+dif] = dec[i]
-		}
-		//fmt.Printf("enc ret data=%d\n", len(data))
-		return data, nil
-	}
-	//fmt.Printf("enc ret dec=%d\n", len(dec))
-	return dec, nil
+	return leftPad(k.encrypt(tmp).Bytes(), size), nil
+}
+
+// SetExpAlgorithm selects the exponentiation used by the public key operations of the key (encryption, signature
+// verification), ExpAuto by default. Private key operations always use the constant time Montgomery exponentiation
+func (k *PublicKey) SetExpAlgorithm(algorithm ExpAlgorithm) {
+	k.exp = algorithm
+}
+
+func (k *PublicKey) encrypt(m *big.Int) *big.Int {
+	switch k.exp {
+	case ExpBinary:
+		return PowModulo(m, k.ee, k.nn)
+	case ExpWindow:
+		return PowModuloWindow(m, k.ee, k.nn)
+	case ExpBig:
+		return big.NewInt(0).Exp(m, k.ee, k.nn)
+	}
+	if k.nn.BitLen() >= expWindowMinBits {
+		return PowModuloWindow(m, k.ee, k.nn)
+	}
+	return big.NewInt(0).Exp(m, k.ee, k.nn)
+}
+
+// size in bytes of the modulus, and so of any padded message or ciphertext
+func (k *PublicKey) size() int {
+	return (k.nn.BitLen() + 7) / 8
 }
 
 func (k *PrivateKey) GetRSAKeySize() int {
 	return k.nn.BitLen()
 }
 
-func (k *PrivateKey) Decrypt(data []byte, size int) ([]byte, error) {
+// DecryptRaw is the counterpart of PublicKey.Encrypt, it decrypts data without any padding scheme
+func (k *PrivateKey) DecryptRaw(data []byte, size int) ([]byte, error) {
 	if len(data) > k.nn.BitLen()/8 {
 		return nil, fmt.Errorf("data too large. It's can exceed %d bytes for this key", k.nn.BitLen()/8)
 	}
 	//fmt.Printf("dec data=%d size=%d\n", len(data), size)
 	tmp := big.NewInt(0)
 	tmp.SetBytes(data)
-	dd := big.NewInt(0)
-	dd.Abs(k.dd)
-	nn := big.NewInt(0)
-	nn.Abs(k.nn)
-	tmp = PowModulo(tmp, dd, nn)
-	dec := tmp.Bytes()
-
-	if len(dec) < size {
-		dif := size - len(dec)
-		data := make([]byte, size, size)
-		for i, _ := range dec {
-			data[i+dif] = dec[i]
+	m, err := k.decrypt(tmp)
+	if err != nil {
+		return nil, err
+	}
+	return leftPad(m.Bytes(), size), nil
+}
+
+// the private key operations of a key without public exponent can't be blinded
+var errNoBlinding = errors.New("the public exponent of the private key is unknown, its operations can't be blinded: save the public key file next to the private key file")
+
+func (k *PrivateKey) decrypt(c *big.Int) (*big.Int, error) {
+	k.ctxOnce.Do(func() {
+		k.ctx = newPrivateContext(k)
+	})
+	if k.noBlinding.Load() {
+		return k.ctx.exp(c, k.dd)
+	}
+	if k.ee == nil {
+		return nil, errNoBlinding
+	}
+	//blinding: (c*r^e)^d = m*r, so the exponentiation doesn't work on the attacker's value
+	r, rInv := k.blindingFactor()
+	c = big.NewInt(0).Mul(c, (&PublicKey{nn: k.nn, ee: k.ee}).encrypt(r))
+	m, err := k.ctx.exp(c.Mod(c, k.nn), k.dd)
+	if err != nil {
+		return nil, err
+	}
+	return m.Mod(m.Mul(m, rInv), k.nn), nil
+}
+
+// returns a fresh random r invertible modulo n and its inverse
+func (k *PrivateKey) blindingFactor() (*big.Int, *big.Int) {
+	for {
+		//crypto/rand doesn't fail
+		r, _ := rand.Int(rand.Reader, k.nn)
+		if r.Cmp(one) <= 0 {
+			continue
+		}
+		if rInv := big.NewInt(0).ModInverse(r, k.nn); rInv != nil {
+			return r, rInv
 		}
-		return data, nil
-		//fmt.Printf("dec ret data=%d\n", len(data))
 	}
+}
 
-	//fmt.Printf("dec ret dec=%d\n", len(dec))
-	return dec, nil
+// SetBlinding enables or disables the ciphertext blinding of private key operations, enabled by default.
+// Blinding protects d against timing attacks, disable it only for benchmarks. Keys without their public exponent
+// (older key files without the .pub file next to them) can't be blinded, their operations fail unless blinding is
+// disabled. It can be called while the key is used by other goroutines
+func (k *PrivateKey) SetBlinding(blinding bool) {
+	k.noBlinding.Store(!blinding)
+}
+
+func (k *PrivateKey) size() int {
+	return (k.nn.BitLen() + 7) / 8
+}
+
+// left pad data with zeros up to size bytes, data larger than size are returned as is
+func leftPad(data []byte, size int) []byte {
+	if len(data) >= size {
+		return data
+	}
+	ret := make([]byte, size, size)
+	copy(ret[size-len(data):], data)
+	return ret
 }
 
 func GetPrivateKey(path string) (*PrivateKey, error) {
@@ -337,6 +341,31 @@ func GetPrivateKey(path string) (*PrivateKey, error) {
 		nn: nn,
 		dd: dd,
 	}
+	//older key files only have n and d
+	if len(keyl) > 2 {
+		ee := big.NewInt(0)
+		fmt.Sscanf(keyl[2], "%x", ee)
+		if ee.Cmp(zero) == 0 {
+			return nil, fmt.Errorf("Error reading private key")
+		}
+		key.ee = ee
+	}
+	if len(keyl) > 3 {
+		for _, hexa := range keyl[3:] {
+			prime := big.NewInt(0)
+			fmt.Sscanf(hexa, "%x", prime)
+			key.primes = append(key.primes, prime)
+		}
+		if err := key.precompute(); err != nil {
+			return nil, fmt.Errorf("Error reading private key: %v", err)
+		}
+	}
+	//e is needed for blinding, take it in the public key file saved along older key files
+	if key.ee == nil && strings.HasSuffix(path, ".key") {
+		if publicKey, err := GetPublicKey(strings.TrimSuffix(path, ".key") + ".pub"); err == nil && publicKey.nn.Cmp(nn) == 0 {
+			key.ee = publicKey.ee
+		}
+	}
 	return key, nil
 }
 
@@ -417,7 +446,7 @@ func TestEncriptDecript2() {
 				return
 			}
 		*/
-		d, _ := privateKey.Decrypt(c, size)
+		d, _ := privateKey.DecryptRaw(c, size)
 		if len(list) != len(d) {
 			fmt.Printf("Error plain versus decrypt data size\n")
 			fmt.Printf("list: %v\n", list)
@@ -465,7 +494,7 @@ func TestEncriptDecript() {
 		}
 	*/
 	fmt.Printf("%d: enc %v\n", len(c), c)
-	d, _ := privateKey.Decrypt(c, size)
+	d, _ := privateKey.DecryptRaw(c, size)
 	fmt.Printf("%d: dec %v\n", len(d), d)
 	if len(list) != len(d) {
 		fmt.Printf("Error plain versus decrypt data size\n")
@@ -0,0 +1,215 @@
+package rsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// dudect: above 10 the time certainly depends on the input, above 4.5 probably
+const TimingLeakThreshold = 10
+
+// TimingResult is the Welch t-test statistic comparing the execution times of an operation on a fixed input
+// and on random inputs (dudect, "Dude, is my code constant time?", Reparaz, Balasch, Verbauwhede 2017)
+type TimingResult struct {
+	Name string
+	//the operation is expected to run in constant time
+	ConstantTime bool
+	Samples      int
+	//largest |t| over the measures cropped at several percentiles, and the percentile giving it
+	T          float64
+	Percentile int
+	//mean times of the fixed and random classes
+	FixedMean  time.Duration
+	RandomMean time.Duration
+}
+
+func (r TimingResult) Leaky() bool {
+	return r.T > TimingLeakThreshold
+}
+
+// an operation to measure on the input of class 0 (fixed) or 1 (random)
+type timingTarget struct {
+	name         string
+	constantTime bool
+	input        func(class int) []byte
+	run          func(input []byte)
+}
+
+// measures are cropped above these percentiles to remove the noise of interrupts and GC, 100 keeps them all
+var timingPercentiles = []int{50, 75, 90, 95, 99, 100}
+
+const minTimingMeasure = 10 * time.Microsecond
+
+// RunTimingTests measures private key decryption, PowModulo and the padding checks on samples executions
+// each, with a key of keyBitSize bits. Decryptions get a fixed small ciphertext or random ones, exponentiations
+// a fixed exponent of low Hamming weight or random ones and padding checks a valid padding or random bytes
+func RunTimingTests(keyBitSize int, samples int, verbose bool) ([]TimingResult, error) {
+	if samples < 100 {
+		return nil, fmt.Errorf("at least 100 samples are needed, got %d", samples)
+	}
+	publicKey, privateKey, err := CreateRSAKey(keyBitSize, false, false)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := timingTargets(publicKey, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	results := []TimingResult{}
+	for _, target := range targets {
+		if verbose {
+			fmt.Printf("measuring %s\n", target.name)
+		}
+		results = append(results, measureTiming(target, samples))
+	}
+	return results, nil
+}
+
+func timingTargets(publicKey *PublicKey, privateKey *PrivateKey) ([]timingTarget, error) {
+	size := privateKey.size()
+	unblinded := &PrivateKey{nn: privateKey.nn, dd: privateKey.dd, ee: privateKey.ee, primes: privateKey.primes, precomputed: privateKey.precomputed}
+	unblinded.noBlinding.Store(true)
+	//random value lower than n
+	randomBlock := func() []byte {
+		r, _ := rand.Int(rand.Reader, privateKey.nn)
+		return leftPad(r.Bytes(), size)
+	}
+	//the fixed value is small, a classic trigger of data dependent big.Int code paths
+	fixedBlock := leftPad([]byte{2}, size)
+	blocks := func(class int) []byte {
+		if class == 0 {
+			return fixedBlock
+		}
+		return randomBlock()
+	}
+	//valid ciphertexts against random ones which almost never have a valid padding
+	pkcs1v15, err := publicKey.EncryptPKCS1v15([]byte("side channel"))
+	if err != nil {
+		return nil, err
+	}
+	oaep, err := publicKey.EncryptOAEP(crypto.SHA256, []byte("side channel"), nil)
+	if err != nil {
+		return nil, err
+	}
+	validOr := func(valid []byte) func(int) []byte {
+		return func(class int) []byte {
+			if class == 0 {
+				return valid
+			}
+			return randomBlock()
+		}
+	}
+	//exponents of the modulus size, the fixed one has a single low bit set
+	exponents := func(class int) []byte {
+		e := randomBlock()
+		if class == 0 {
+			e = make([]byte, size)
+			e[size-1] = 1
+		}
+		e[0] |= 0x80 >> uint(size*8-privateKey.nn.BitLen())
+		return e
+	}
+	base, _ := rand.Int(rand.Reader, privateKey.nn)
+	em := make([]byte, size)
+	em[1] = 2
+	for i := 2; i < size-17; i++ {
+		em[i] = 0xff
+	}
+	return []timingTarget{
+		{"Decrypt", true, blocks, func(in []byte) { privateKey.DecryptRaw(in, size) }},
+		{"Decrypt without blinding", true, blocks, func(in []byte) { unblinded.DecryptRaw(in, size) }},
+		{"PowModulo", false, exponents, func(in []byte) { PowModulo(base, big.NewInt(0).SetBytes(in), privateKey.nn) }},
+		{"PowModuloMontgomery", true, exponents, func(in []byte) {
+			PowModuloMontgomery(base, big.NewInt(0).SetBytes(in), privateKey.nn)
+		}},
+		{"PKCS#1 v1.5 padding check", true, validOr(em), func(in []byte) { checkPKCS1v15Padding(in) }},
+		{"DecryptPKCS1v15Implicit", true, validOr(pkcs1v15), func(in []byte) { privateKey.DecryptPKCS1v15Implicit(in) }},
+		{"DecryptOAEP", true, validOr(oaep), func(in []byte) { privateKey.DecryptOAEP(crypto.SHA256, in, nil) }},
+	}, nil
+}
+
+func measureTiming(target timingTarget, samples int) TimingResult {
+	classes := make([]int, samples)
+	inputs := make([][]byte, samples)
+	random := make([]byte, samples)
+	rand.Read(random)
+	for i := range classes {
+		classes[i] = int(random[i] & 1)
+		//each sample gets its own buffer, a fixed input always in cache would be faster
+		inputs[i] = append([]byte(nil), target.input(classes[i])...)
+	}
+	times := make([]float64, samples)
+	//warm up caches and lazy precomputations
+	fastest := time.Hour
+	for i := 0; i < 10 && i < samples; i++ {
+		t0 := time.Now()
+		target.run(inputs[i])
+		if d := time.Since(t0); d < fastest {
+			fastest = d
+		}
+	}
+	//fast operations are repeated, the resolution and the cost of the clock would hide their variations
+	repeat := 1
+	if fastest < minTimingMeasure {
+		repeat = int(minTimingMeasure/(fastest+1)) + 1
+	}
+	runtime.GC()
+	for i, input := range inputs {
+		t0 := time.Now()
+		for j := 0; j < repeat; j++ {
+			target.run(input)
+		}
+		times[i] = float64(time.Since(t0)) / float64(repeat)
+	}
+	sorted := append([]float64(nil), times...)
+	sort.Float64s(sorted)
+	result := TimingResult{Name: target.name, ConstantTime: target.constantTime, Samples: samples}
+	for _, percentile := range timingPercentiles {
+		limit := sorted[(len(sorted)-1)*percentile/100]
+		var stats [2]welford
+		for i, t := range times {
+			if t <= limit {
+				stats[classes[i]].add(t)
+			}
+		}
+		t := math.Abs(welchT(stats[0], stats[1]))
+		if t > result.T || percentile == 100 && result.Percentile == 0 {
+			result.T, result.Percentile = t, percentile
+		}
+		if percentile == 100 {
+			result.FixedMean, result.RandomMean = time.Duration(stats[0].mean), time.Duration(stats[1].mean)
+		}
+	}
+	return result
+}
+
+// online mean and variance
+type welford struct {
+	n    float64
+	mean float64
+	m2   float64
+}
+
+func (w *welford) add(x float64) {
+	w.n++
+	delta := x - w.mean
+	w.mean += delta / w.n
+	w.m2 += delta * (x - w.mean)
+}
+
+func welchT(a welford, b welford) float64 {
+	if a.n < 2 || b.n < 2 {
+		return 0
+	}
+	se := math.Sqrt(a.m2/(a.n-1)/a.n + b.m2/(b.n-1)/b.n)
+	if se == 0 {
+		return 0
+	}
+	return (a.mean - b.mean) / se
+}
@@ -0,0 +1,109 @@
+package rsa
+
+import (
+	"crypto"
+	gorsa "crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	SchemePSS      = "pss"
+	SchemePKCS1v15 = "pkcs1v15"
+)
+
+// Sign signs digest, the hash of the message computed with opts.HashFunc().
+// opts being a *crypto/rsa.PSSOptions selects RSASSA-PSS, otherwise RSASSA-PKCS1-v1_5 is used
+func (k *PrivateKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if pssOpts, ok := opts.(*gorsa.PSSOptions); ok {
+		return k.SignPSS(pssOpts.HashFunc(), digest, pssOpts.SaltLength)
+	}
+	return k.SignPKCS1v15(opts.HashFunc(), digest)
+}
+
+func (k *PublicKey) Verify(digest []byte, sig []byte, opts crypto.SignerOpts) error {
+	if pssOpts, ok := opts.(*gorsa.PSSOptions); ok {
+		return k.VerifyPSS(pssOpts.HashFunc(), digest, sig, pssOpts.SaltLength)
+	}
+	return k.VerifyPKCS1v15(opts.HashFunc(), digest, sig)
+}
+
+func GetHash(name string) (crypto.Hash, error) {
+	switch strings.ToLower(name) {
+	case "sha256", "sha-256":
+		return crypto.SHA256, nil
+	case "sha384", "sha-384":
+		return crypto.SHA384, nil
+	case "sha512", "sha-512":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported hash: %s, should be sha256, sha384 or sha512", name)
+}
+
+func getSignerOpts(scheme string, hash crypto.Hash) (crypto.SignerOpts, error) {
+	switch scheme {
+	case SchemePSS:
+		return &gorsa.PSSOptions{Hash: hash, SaltLength: PSSSaltLengthEqualsHash}, nil
+	case SchemePKCS1v15:
+		return hash, nil
+	}
+	return nil, fmt.Errorf("unsupported signature scheme: %s, should be %s or %s", scheme, SchemePSS, SchemePKCS1v15)
+}
+
+func hashFile(path string, hash crypto.Hash) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	h := hash.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func SignFile(sourcePath string, signaturePath string, keyPath string, scheme string, hash crypto.Hash) error {
+	privateKey, errp := GetPrivateKey(keyPath)
+	if errp != nil {
+		return errp
+	}
+	opts, err := getSignerOpts(scheme, hash)
+	if err != nil {
+		return err
+	}
+	digest, err := hashFile(sourcePath, hash)
+	if err != nil {
+		return err
+	}
+	sig, err := privateKey.Sign(nil, digest, opts)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(signaturePath, sig, 0666)
+}
+
+func VerifyFile(sourcePath string, signaturePath string, keyPath string, scheme string, hash crypto.Hash) error {
+	publicKey, errp := GetPublicKey(keyPath)
+	if errp != nil {
+		return errp
+	}
+	opts, err := getSignerOpts(scheme, hash)
+	if err != nil {
+		return err
+	}
+	sig, err := ioutil.ReadFile(signaturePath)
+	if err != nil {
+		return err
+	}
+	digest, err := hashFile(sourcePath, hash)
+	if err != nil {
+		return err
+	}
+	return publicKey.Verify(digest, sig, opts)
+}
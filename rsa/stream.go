@@ -0,0 +1,569 @@
+package rsa
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// NewEncryptWriter returns a writer encrypting in rsa mode what is written to it into w.
+// Close writes the end of the data, it doesn't close w
+func NewEncryptWriter(w io.Writer, publicKey *PublicKey) (io.WriteCloser, error) {
+	return NewEncryptWriterWithOptions(w, []*PublicKey{publicKey}, nil)
+}
+
+// NewEncryptWriterWithOptions encrypts for all the public keys, which needs the hybrid mode if there are several.
+// options.Recipients is only used by the file functions
+func NewEncryptWriterWithOptions(w io.Writer, publicKeys []*PublicKey, options *EncryptOptions) (io.WriteCloser, error) {
+	return NewEncryptWriterContext(context.Background(), w, publicKeys, options)
+}
+
+// NewEncryptWriterContext encrypts the blocks on options.Workers goroutines, Write and Close fail once ctx is cancelled
+func NewEncryptWriterContext(ctx context.Context, w io.Writer, publicKeys []*PublicKey, options *EncryptOptions) (io.WriteCloser, error) {
+	if options == nil {
+		options = &EncryptOptions{}
+	}
+	return newEncryptWriter(ctx, w, publicKeys, options, fileHeader{Length: -1})
+}
+
+// the compression of options is none, gzip, zstd or auto, auto is decided on the first data written. base holds the
+// header fields known by the caller
+func newEncryptWriter(ctx context.Context, w io.Writer, publicKeys []*PublicKey, options *EncryptOptions, base fileHeader) (io.WriteCloser, error) {
+	mode := options.Mode
+	if err := checkMode(mode, len(publicKeys)); err != nil {
+		return nil, err
+	}
+	if err := checkCompression(options.Compression); err != nil {
+		return nil, err
+	}
+	if mode == "" {
+		mode = ModeRSA
+	}
+	var armor io.WriteCloser
+	if options.Armor {
+		var err error
+		if armor, err = NewArmorWriter(w, map[string]string{"Mode": mode}); err != nil {
+			return nil, err
+		}
+		w = armor
+	}
+	progress := newProgress(options.Progress, base.Length)
+	create := func(compression string) (io.WriteCloser, error) {
+		header := &base
+		header.Mode = mode
+		if compression == CompressionGzip || compression == CompressionZstd {
+			header.Compression = compression
+		}
+		var encrypt io.WriteCloser
+		var err error
+		if mode == ModeHybrid {
+			encrypt, err = newHybridWriter(ctx, w, publicKeys, header, options.Workers, progress)
+		} else {
+			encrypt, err = newRSAWriter(ctx, w, publicKeys[0], header, options.Workers, progress)
+		}
+		if err != nil || header.Compression == "" {
+			return encrypt, err
+		}
+		compressor, err := newCompressor(header.Compression, encrypt)
+		if err != nil {
+			return nil, err
+		}
+		return &compressWriter{WriteCloser: compressor, encrypt: encrypt}, nil
+	}
+	var encrypt io.WriteCloser = &autoCompressWriter{create: create}
+	if options.Compression != CompressionAuto {
+		var err error
+		if encrypt, err = create(options.Compression); err != nil {
+			return nil, err
+		}
+	}
+	if progress != nil {
+		encrypt = &progressWriter{WriteCloser: encrypt, progress: progress}
+	}
+	if armor == nil {
+		return encrypt, nil
+	}
+	return &armoredWriter{WriteCloser: encrypt, armor: armor}, nil
+}
+
+// armoredWriter closes the encrypt writer then the armor
+type armoredWriter struct {
+	io.WriteCloser
+	armor io.WriteCloser
+}
+
+func (a *armoredWriter) Close() error {
+	if err := a.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return a.armor.Close()
+}
+
+func checkMode(mode string, recipients int) error {
+	if mode != "" && mode != ModeRSA && mode != ModeOAEP && mode != ModeHybrid {
+		return fmt.Errorf("unknown mode: %s, should be %s, %s or %s", mode, ModeRSA, ModeOAEP, ModeHybrid)
+	}
+	if recipients == 0 {
+		return fmt.Errorf("no public key")
+	}
+	if recipients > 1 && mode != ModeHybrid {
+		return fmt.Errorf("several recipients need the %s mode", ModeHybrid)
+	}
+	return nil
+}
+
+type DecryptOptions struct {
+	//number of goroutines decrypting the blocks, one if lower than 2
+	Workers int
+	//called after each block decrypted, see Progress
+	Progress func(Progress)
+	//accept the rsa mode files without MAC written by the previous versions, a modification of their blocks
+	//can't be detected
+	AllowUnauthenticated bool
+	//set the permission bits and modification time stored with EncryptOptions.Metadata on the decrypted file,
+	//used by DecryptFile only
+	RestoreMetadata bool
+}
+
+// NewDecryptReader returns a reader decrypting r, the mode is read in the header and ASCII armor is detected.
+// The key is checked before returning, a corrupted file makes Read fail: the data read before the error should
+// be discarded, the end of the file is needed to authenticate it. Data without header or MAC, written by the previous versions, are
+// refused with ErrUnauthenticated, see DecryptOptions.AllowUnauthenticated
+func NewDecryptReader(r io.Reader, privateKey *PrivateKey) (io.Reader, error) {
+	return NewDecryptReaderContext(context.Background(), r, privateKey, nil)
+}
+
+// NewDecryptReaderContext decrypts the blocks on options.Workers goroutines, reading r ahead: cancel ctx to stop
+// them if the reader is not read to the end. Read fails once ctx is cancelled
+func NewDecryptReaderContext(ctx context.Context, r io.Reader, privateKey *PrivateKey, options *DecryptOptions) (io.Reader, error) {
+	reader, _, err := newDecryptReader(ctx, r, privateKey, options)
+	return reader, err
+}
+
+// returns the header too, an empty rsa mode header for the files without header
+func newDecryptReader(ctx context.Context, r io.Reader, privateKey *PrivateKey, options *DecryptOptions) (io.Reader, *fileHeader, error) {
+	if options == nil {
+		options = &DecryptOptions{}
+	}
+	br := bufio.NewReader(r)
+	if isArmored(br) {
+		armor, _, err := NewArmorReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		br = bufio.NewReader(armor)
+	}
+	//a legacy file starts with the magic bytes with a probability of 2^-48
+	if magic, _ := br.Peek(len(fileMagic)); string(magic) != fileMagic {
+		if !options.AllowUnauthenticated {
+			return nil, nil, ErrUnauthenticated
+		}
+		header := &fileHeader{Mode: ModeRSA, Length: -1}
+		decoder := newRSAReader(br, privateKey, header, nil)
+		progress := newProgress(options.Progress, -1)
+		blocks := newBlockReader(ctx, decoder, options.Workers)
+		blocks.progress = progress
+		return progressReaderOf(&decryptReader{blocks: blocks}, progress), header, nil
+	}
+	header, err := readHeader(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := header.checkKey(privateKey); err != nil {
+		return nil, nil, err
+	}
+	var decoder bodyDecoder
+	var verifier bodyVerifier
+	if header.Mode == ModeHybrid {
+		if decoder, err = newHybridReader(br, privateKey, header); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		var mac *blockMAC
+		if header.MAC != "" {
+			macKey, err := privateKey.Decapsulate(header.MACKey)
+			if err != nil {
+				return nil, nil, ErrAuthentication
+			}
+			raw, err := header.marshal()
+			if err != nil {
+				return nil, nil, err
+			}
+			mac = newBlockMAC(macKey, raw)
+		} else if !options.AllowUnauthenticated {
+			return nil, nil, ErrUnauthenticated
+		}
+		rsaDecoder := newRSAReader(br, privateKey, header, mac)
+		if mac != nil {
+			verifier = rsaDecoder
+		}
+		decoder = rsaDecoder
+	}
+	progress := newProgress(options.Progress, header.Length)
+	blocks := newBlockReader(ctx, decoder, options.Workers)
+	blocks.progress = progress
+	body := &decryptReader{blocks: blocks, verifier: verifier}
+	var reader io.Reader = body
+	if header.Compression != "" {
+		reader = newDecompressReader(reader, header.Compression)
+	}
+	if header.Length >= 0 {
+		reader = &lengthReader{r: reader, length: header.Length}
+	}
+	if verifier != nil {
+		reader = &authenticatedReader{r: reader, body: body}
+	}
+	return progressReaderOf(reader, progress), header, nil
+}
+
+// reads the body of a file piece by piece and returns the task decrypting each piece, io.EOF after the last one
+type bodyDecoder interface {
+	next() (blockTask, error)
+}
+
+// bodyVerifier authenticates the decrypted pieces of a body: add is called with each piece in order and check
+// after the last one, before io.EOF is returned
+type bodyVerifier interface {
+	add(data []byte)
+	check() error
+}
+
+type decryptReader struct {
+	blocks *blockReader
+	//nil if the pieces are authenticated by their decryption
+	verifier bodyVerifier
+	buf      []byte
+	err      error
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.next()
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() {
+	d.buf, d.err = d.blocks.next()
+	if d.verifier == nil {
+		return
+	}
+	if d.err == nil {
+		d.verifier.add(d.buf)
+	} else if d.err == io.EOF {
+		if err := d.verifier.check(); err != nil {
+			d.err = err
+		}
+	}
+}
+
+// reads the rest of the body, returns io.EOF or the error which stopped it
+func (d *decryptReader) drain() error {
+	for d.err == nil {
+		d.next()
+	}
+	return d.err
+}
+
+// authenticatedReader returns ErrAuthentication rather than the error of the processing of the data decrypted,
+// like their decompression, when the body has been modified: the rest of the body is read to check its MAC
+type authenticatedReader struct {
+	r    io.Reader
+	body *decryptReader
+}
+
+func (a *authenticatedReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if err != nil && err != io.EOF && a.body.drain() == ErrAuthentication {
+		err = ErrAuthentication
+	}
+	return n, err
+}
+
+// pure RSA modes: blocks encrypted with the key, a trailer holding the size of the last block on 2 bytes little
+// endian, the block tree when the size of the data is known (see tree.go) and the MAC tag. In rsa mode the blocks hold the key size minus one byte and are encrypted as is, equal
+// blocks give equal encrypted blocks. In rsa-oaep mode they are padded with RSA-OAEP, randomized: two
+// encryptions of the same data differ and repeated blocks can't be linked
+type rsaWriter struct {
+	w         io.Writer
+	out       *blockWriter
+	mac       *blockMAC
+	publicKey *PublicKey
+	mode      string
+	block     []byte
+	size      int
+	lastN     int
+	length    int64
+	//nil without block tree
+	tree     *treeBuilder
+	expected int64
+	raw      []byte
+}
+
+const (
+	rsaTrailerSize = 2
+	oaepBlockHash  = crypto.SHA256
+)
+
+// size of the encrypted blocks and of the data they hold
+func rsaBlockSizes(mode string, nn *big.Int) (int, int) {
+	size := nn.BitLen() / 8
+	if mode == ModeOAEP {
+		size = (nn.BitLen() + 7) / 8
+	}
+	return size, rsaDataSize(mode, size)
+}
+
+// size of the data held by the blocks of size bytes
+func rsaDataSize(mode string, size int) int {
+	if mode == ModeOAEP {
+		return size - 2*oaepBlockHash.Size() - 2
+	}
+	return size - 1
+}
+
+// header holds the mode and the common fields
+func newRSAWriter(ctx context.Context, w io.Writer, publicKey *PublicKey, header *fileHeader, workers int, progress *progress) (*rsaWriter, error) {
+	mode := header.Mode
+	size, dataSize := rsaBlockSizes(mode, publicKey.nn)
+	//the end of the file must be shorter than a block
+	if dataSize <= 0 || size <= rsaTrailerSize+macSize {
+		return nil, fmt.Errorf("key too small for the %s mode (%d bits)", mode, publicKey.nn.BitLen())
+	}
+	macKey, encapsulation, err := publicKey.Encapsulate()
+	if err != nil {
+		return nil, err
+	}
+	header.BlockSize, header.Fingerprint, header.MAC, header.MACKey = size, publicKey.Fingerprint(), fileMAC, encapsulation
+	//the reader needs the number of blocks to find the tree
+	if header.Length >= 0 && header.Compression == "" {
+		header.Tree, header.TreeSegment = fileTree, treeSegmentBlocks(size)
+	}
+	raw, err := header.marshal()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	mac := newBlockMAC(macKey, raw)
+	e := &rsaWriter{
+		w:         w,
+		mac:       mac,
+		publicKey: publicKey,
+		mode:      mode,
+		block:     make([]byte, 0, dataSize),
+		size:      size,
+	}
+	if header.Tree != "" {
+		e.tree, e.expected, e.raw = newTreeBuilder(header.TreeSegment, macKey), header.Length, raw
+	}
+	e.out = newBlockWriter(ctx, w, workers)
+	e.out.progress = progress
+	return e, nil
+}
+
+func (e *rsaWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.block[len(e.block):cap(e.block)], p)
+		e.block = e.block[:len(e.block)+n]
+		p = p[n:]
+		written += n
+		if len(e.block) == cap(e.block) {
+			if err := e.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (e *rsaWriter) flush() error {
+	block := append([]byte(nil), e.block...)
+	e.mac.add(block)
+	if e.tree != nil {
+		e.tree.add(block)
+	}
+	e.lastN = len(block)
+	e.length += int64(len(block))
+	e.block = e.block[:0]
+	return e.out.write(func() ([]byte, error) {
+		if e.mode == ModeOAEP {
+			return e.publicKey.EncryptOAEP(oaepBlockHash, block, nil)
+		}
+		return e.publicKey.Encrypt(block, e.size)
+	})
+}
+
+func (e *rsaWriter) Close() error {
+	if len(e.block) > 0 {
+		if err := e.flush(); err != nil {
+			e.out.close()
+			return err
+		}
+	}
+	//the tree is located with the size of the header
+	if e.tree != nil && e.length != e.expected {
+		e.out.close()
+		return fmt.Errorf("%d bytes encrypted, %d expected: the file has changed during the encryption", e.length, e.expected)
+	}
+	if err := e.out.close(); err != nil {
+		return err
+	}
+	//the trailer follows the blocks in the MAC but is not a block
+	trailer := []byte{byte(e.lastN % 256), byte(e.lastN / 256)}
+	e.mac.add(trailer)
+	if _, err := e.out.w.Write(trailer); err != nil {
+		return err
+	}
+	if e.tree != nil {
+		section := e.tree.section(e.raw)
+		e.mac.add(section)
+		if _, err := e.w.Write(section); err != nil {
+			return err
+		}
+	}
+	_, err := e.w.Write(e.mac.sum(uint64(e.length)))
+	return err
+}
+
+type rsaReader struct {
+	r          io.Reader
+	privateKey *PrivateKey
+	mode       string
+	size       int
+	dataSize   int
+	//nil for the files without MAC, the end of the file is kept for its check after the last block and length
+	//counts the data added
+	mac    *blockMAC
+	end    []byte
+	length uint64
+	//number of blocks and size of the tree for the files with block tree, count is -1 without tree
+	count    int64
+	treeSize int64
+	//block read ahead, the trailer is only known after the last block
+	pending []byte
+	blocks  uint64
+	data    []byte
+	done    bool
+}
+
+func newRSAReader(r io.Reader, privateKey *PrivateKey, header *fileHeader, mac *blockMAC) *rsaReader {
+	size, dataSize := rsaBlockSizes(header.Mode, privateKey.nn)
+	d := &rsaReader{r: r, privateKey: privateKey, mode: header.Mode, size: size, dataSize: dataSize, mac: mac, count: -1, data: make([]byte, size)}
+	if header.Tree != "" {
+		d.count = treeBlocks(header.Length, dataSize)
+		d.treeSize = treeSectionSize(d.count, header.TreeSegment)
+	}
+	return d
+}
+
+func (d *rsaReader) decrypt(block []byte) ([]byte, error) {
+	if d.mode == ModeOAEP {
+		return d.privateKey.DecryptOAEP(oaepBlockHash, block, nil)
+	}
+	return d.privateKey.DecryptRaw(block, d.dataSize)
+}
+
+func (d *rsaReader) next() (blockTask, error) {
+	for !d.done {
+		if d.count >= 0 && d.blocks == uint64(d.count) {
+			//the end of the file follows the last block, it is longer than a block with the tree
+			end := make([]byte, rsaTrailerSize+d.treeSize+macSize+1)
+			n, err := io.ReadFull(d.r, end)
+			if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+				return nil, err
+			}
+			return d.last(end[:n])
+		}
+		n, err := io.ReadFull(d.r, d.data)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+		if n == len(d.data) {
+			d.blocks++
+			block := d.pending
+			d.pending = append(d.data[:0:0], d.data...)
+			if block != nil {
+				return func() ([]byte, error) {
+					return d.decrypt(block)
+				}, nil
+			}
+			continue
+		}
+		return d.last(d.data[:n])
+	}
+	return nil, io.EOF
+}
+
+// checks the end of the file and returns the task decrypting the last block
+func (d *rsaReader) last(end []byte) (blockTask, error) {
+	d.done = true
+	if err := d.checkEnd(end); err != nil {
+		return nil, err
+	}
+	lastN := int(end[0]) + int(end[1])*256
+	if d.pending == nil {
+		if lastN != 0 {
+			return nil, fmt.Errorf("corrupted data: last block missing")
+		}
+		return nil, io.EOF
+	}
+	if lastN > d.dataSize || lastN == 0 {
+		return nil, fmt.Errorf("corrupted data: invalid last block size %d", lastN)
+	}
+	block := d.pending
+	return func() ([]byte, error) {
+		data, err := d.decrypt(block)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < lastN {
+			return nil, fmt.Errorf("corrupted data: invalid last block size %d", lastN)
+		}
+		return data[len(data)-lastN:], nil
+	}, nil
+}
+
+// checks the size of the end of the file, the MAC tag is checked by check once the data have been decrypted
+func (d *rsaReader) checkEnd(end []byte) error {
+	if d.mac == nil {
+		if len(end) != rsaTrailerSize {
+			return fmt.Errorf("corrupted data: %d bytes after the last block", len(end))
+		}
+		return nil
+	}
+	if int64(len(end)) != rsaTrailerSize+d.treeSize+macSize {
+		return ErrAuthentication
+	}
+	d.end = end
+	return nil
+}
+
+// adds the data of a block to the MAC, the blocks are added in order
+func (d *rsaReader) add(data []byte) {
+	d.mac.add(data)
+	d.length += uint64(len(data))
+}
+
+// checks the MAC tag after the last block, everything read before is authenticated. The tree is authenticated as
+// a block, it is only read by DecryptRange
+func (d *rsaReader) check() error {
+	if d.end == nil {
+		return ErrAuthentication
+	}
+	d.mac.add(d.end[:rsaTrailerSize])
+	if d.treeSize > 0 {
+		d.mac.add(d.end[rsaTrailerSize : rsaTrailerSize+d.treeSize])
+	}
+	return d.mac.check(d.length, d.end[rsaTrailerSize+d.treeSize:])
+}
@@ -0,0 +1,198 @@
+package rsa
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Block hash tree of the rsa mode files, written when the size of the data is known: the leaves are the HMAC of
+// the data of segments of about 64KB of blocks, the nodes the SHA-256 of their two children, the last node of a
+// level without sibling is moved up as is. The levels are written after the trailer from the leaves to the root,
+// followed by a HMAC of the header and the root. The leaves cover the data rather than the encrypted blocks, like
+// the MAC of the file, so that the tree can't be computed again with a new key without decrypting the blocks. A
+// range of the file is verified decrypting only its segments and reading the nodes on their path to the root
+const (
+	fileTree     = "merkle-sha256"
+	treeSegment  = 64 * 1024
+	treeNodeSize = sha256.Size
+)
+
+// number of blocks in a leaf
+func treeSegmentBlocks(blockSize int) int {
+	if blockSize >= treeSegment {
+		return 1
+	}
+	return treeSegment / blockSize
+}
+
+// number of blocks of a file of length bytes
+func treeBlocks(length int64, dataSize int) int64 {
+	return (length + int64(dataSize) - 1) / int64(dataSize)
+}
+
+// number of nodes of each level from the leaves to the root, an empty tree has only a root
+func treeLevelSizes(blocks int64, segment int) []int64 {
+	leaves := (blocks + int64(segment) - 1) / int64(segment)
+	if leaves == 0 {
+		return []int64{1}
+	}
+	sizes := []int64{leaves}
+	for leaves > 1 {
+		leaves = (leaves + 1) / 2
+		sizes = append(sizes, leaves)
+	}
+	return sizes
+}
+
+// size of the tree written after the trailer, tag included
+func treeSectionSize(blocks int64, segment int) int64 {
+	nodes := int64(0)
+	for _, size := range treeLevelSizes(blocks, segment) {
+		nodes += size
+	}
+	return nodes*treeNodeSize + macSize
+}
+
+func treeNode(left []byte, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// the leaves and the tag of the root are keyed with a key derived from the MAC key of the file
+func treeKey(macKey []byte) []byte {
+	key := hmac.New(sha256.New, macKey)
+	key.Write([]byte("cipher block tree"))
+	return key.Sum(nil)
+}
+
+// hash of the data of the blocks of a leaf
+func newLeafHash(key []byte) hash.Hash {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte{0})
+	return h
+}
+
+func treeTag(key []byte, header []byte, root []byte) []byte {
+	tag := hmac.New(sha256.New, key)
+	tag.Write(header)
+	tag.Write(root)
+	return tag.Sum(nil)
+}
+
+// treeBuilder hashes the data of the blocks in order and returns the tree at the end
+type treeBuilder struct {
+	segment int
+	key     []byte
+	blocks  int
+	leaf    hash.Hash
+	leaves  [][]byte
+}
+
+func newTreeBuilder(segment int, macKey []byte) *treeBuilder {
+	return &treeBuilder{segment: segment, key: treeKey(macKey)}
+}
+
+func (t *treeBuilder) add(data []byte) {
+	if t.leaf == nil {
+		t.leaf = newLeafHash(t.key)
+	}
+	t.leaf.Write(data)
+	t.blocks++
+	if t.blocks == t.segment {
+		t.endLeaf()
+	}
+}
+
+func (t *treeBuilder) endLeaf() {
+	t.leaves = append(t.leaves, t.leaf.Sum(nil))
+	t.leaf, t.blocks = nil, 0
+}
+
+// returns the levels and the tag as written in the file
+func (t *treeBuilder) section(header []byte) []byte {
+	if t.blocks > 0 {
+		t.endLeaf()
+	}
+	level := t.leaves
+	if len(level) == 0 {
+		empty := sha256.Sum256(nil)
+		level = [][]byte{empty[:]}
+	}
+	section := []byte{}
+	for {
+		for _, node := range level {
+			section = append(section, node...)
+		}
+		if len(level) == 1 {
+			break
+		}
+		next := [][]byte{}
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, treeNode(level[i], level[i+1]))
+			}
+		}
+		level = next
+	}
+	return append(section, treeTag(t.key, header, level[0])...)
+}
+
+// treeReader verifies the data of segments of blocks reading the nodes of their path in the file
+type treeReader struct {
+	r      io.ReaderAt
+	offset int64
+	sizes  []int64
+	key    []byte
+	root   []byte
+}
+
+// reads the root at the end of the tree written at offset in r and checks its tag
+func newTreeReader(r io.ReaderAt, offset int64, blocks int64, segment int, macKey []byte, header []byte) (*treeReader, error) {
+	t := &treeReader{r: r, offset: offset, sizes: treeLevelSizes(blocks, segment), key: treeKey(macKey)}
+	end := make([]byte, treeNodeSize+macSize)
+	if _, err := r.ReadAt(end, offset+treeSectionSize(blocks, segment)-int64(len(end))); err != nil {
+		return nil, fmt.Errorf("can't read the block tree: %v", err)
+	}
+	t.root = end[:treeNodeSize]
+	if !hmac.Equal(treeTag(t.key, header, t.root), end[treeNodeSize:]) {
+		return nil, ErrAuthentication
+	}
+	return t, nil
+}
+
+// checks the data of the blocks of the leaf index
+func (t *treeReader) verify(index int64, blocks [][]byte) error {
+	h := newLeafHash(t.key)
+	for _, data := range blocks {
+		h.Write(data)
+	}
+	hash := h.Sum(nil)
+	level := int64(0)
+	node := make([]byte, treeNodeSize)
+	for _, size := range t.sizes[:len(t.sizes)-1] {
+		if sibling := index ^ 1; sibling < size {
+			if _, err := t.r.ReadAt(node, t.offset+(level+sibling)*treeNodeSize); err != nil {
+				return fmt.Errorf("can't read the block tree: %v", err)
+			}
+			if index%2 == 0 {
+				hash = treeNode(hash, node)
+			} else {
+				hash = treeNode(node, hash)
+			}
+		}
+		index /= 2
+		level += size
+	}
+	if !hmac.Equal(hash, t.root) {
+		return ErrAuthentication
+	}
+	return nil
+}
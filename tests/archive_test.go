@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/freignat91/cipher/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// creates a tree with files, an empty directory, a symbolic link, modes and times
+func createTree(t *testing.T, dir string) map[string][]byte {
+	files := map[string][]byte{
+		"a.txt":         []byte("some text\n"),
+		"empty":         {},
+		"sub/b.bin":     make([]byte, 300000),
+		"sub/deep/c.sh": []byte("#!/bin/sh\necho ok\n"),
+	}
+	rand.Read(files["sub/b.bin"])
+	for name, data := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "emptydir"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "sub/deep/c.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../a.txt", filepath.Join(dir, "sub/link")); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, name := range []string{"a.txt", "sub/deep", "sub"} {
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func checkTree(t *testing.T, dir string, files map[string][]byte) {
+	for name, data := range files {
+		result, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result, data) {
+			t.Fatalf("%s differs from the source", name)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, "sub/deep/c.sh")); err != nil || info.Mode().Perm() != 0755 {
+		t.Fatalf("mode of c.sh not restored: %v %v", info, err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "emptydir")); err != nil || !info.IsDir() || info.Mode().Perm() != 0750 {
+		t.Fatalf("empty directory not restored: %v %v", info, err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, name := range []string{"a.txt", "sub/deep", "sub"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || !info.ModTime().Equal(mtime) {
+			t.Fatalf("time of %s not restored: %v %v", name, info, err)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "sub/link")); err != nil || target != "../a.txt" {
+		t.Fatalf("symbolic link not restored: %s %v", target, err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	_, path := createGoKey(t, 2048)
+	source := t.TempDir()
+	files := createTree(t, source)
+	for _, options := range []*rsa.EncryptOptions{nil, {Mode: rsa.ModeOAEP, Compression: rsa.CompressionAuto}, {Mode: rsa.ModeHybrid}} {
+		dir := t.TempDir()
+		//the archive is written in the archived directory, it must not archive itself
+		archive := filepath.Join(source, "archive")
+		if err := rsa.EncryptDir(source, archive, path+".pub", options); err != nil {
+			t.Fatalf("Error on EncryptDir: %v\n", err)
+		}
+		target := filepath.Join(dir, "target")
+		if err := rsa.DecryptDir(archive, target, path+".key", nil); err != nil {
+			t.Fatalf("Error on DecryptDir: %v\n", err)
+		}
+		checkTree(t, target, files)
+		if _, err := os.Lstat(filepath.Join(target, "archive")); err == nil {
+			t.Fatal("the archive has been archived")
+		}
+		entries, err := rsa.ListArchive(archive, path+".key", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types := map[string]string{}
+		for _, entry := range entries {
+			types[entry.Path] = entry.Type
+			if entry.Path == "sub/b.bin" && entry.Size != 300000 {
+				t.Fatalf("unexpected size of sub/b.bin: %d", entry.Size)
+			}
+		}
+		for name, typ := range map[string]string{".": rsa.EntryDir, "a.txt": rsa.EntryFile, "emptydir": rsa.EntryDir, "sub/link": rsa.EntrySymlink} {
+			if types[name] != typ {
+				t.Fatalf("%s listed as %q, %s expected", name, types[name], typ)
+			}
+		}
+		//the target directory is never overwritten
+		if err := rsa.DecryptDir(archive, target, path+".key", nil); err == nil {
+			t.Fatal("DecryptDir should refuse an existing directory")
+		}
+		if err := rsa.DecryptFile(archive, filepath.Join(dir, "file"), path+".key"); err == nil {
+			t.Fatal("DecryptFile should refuse an archive")
+		}
+		os.Remove(archive)
+	}
+}
+
+func TestArchiveTampering(t *testing.T) {
+	_, path := createGoKey(t, 2048)
+	source := t.TempDir()
+	createTree(t, source)
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "archive")
+	for _, mode := range []string{rsa.ModeRSA, rsa.ModeHybrid} {
+		if err := rsa.EncryptDir(source, archive, path+".pub", &rsa.EncryptOptions{Mode: mode}); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-100] ^= 1
+		if err := ioutil.WriteFile(archive, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		//nothing is left when the authentication fails at the end
+		target := filepath.Join(dir, "target")
+		if err := rsa.DecryptDir(archive, target, path+".key", nil); err == nil {
+			t.Fatalf("%s: decryption of an altered archive should fail", mode)
+		}
+		if _, err := os.Lstat(target); err == nil {
+			t.Fatalf("%s: the altered archive has been extracted", mode)
+		}
+		if names, _ := filepath.Glob(filepath.Join(dir, "target*")); len(names) > 0 {
+			t.Fatalf("%s: temporary directory left: %v", mode, names)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/freignat91/cipher/rsa"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func armor(t *testing.T, data []byte, headers map[string]string) string {
+	out := &bytes.Buffer{}
+	w, err := rsa.NewArmorWriter(out, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func unarmor(text string) ([]byte, map[string]string, error) {
+	r, headers, err := rsa.NewArmorReader(strings.NewReader(text))
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ioutil.ReadAll(r)
+	return data, headers, err
+}
+
+func TestArmor(t *testing.T) {
+	//CRC-24 check value of OpenPGP: 0x21cf02
+	text := armor(t, []byte("123456789"), nil)
+	if text != "-----BEGIN CIPHER MESSAGE-----\n\nMTIzNDU2Nzg5\n=Ic8C\n-----END CIPHER MESSAGE-----\n" {
+		t.Fatalf("unexpected armor:\n%s", text)
+	}
+	for _, size := range []int{0, 1, 47, 48, 49, 1000} {
+		data := make([]byte, size)
+		rand.Read(data)
+		text := armor(t, data, map[string]string{"Mode": "rsa", "Comment": "test"})
+		for _, line := range strings.Split(text, "\n") {
+			if len(line) > 64 {
+				t.Fatalf("line too long: %s", line)
+			}
+		}
+		//line ends, blank lines and line length may change when the text is copied
+		copies := []string{text, strings.Replace(text, "\n", "\r\n", -1), "\n  " + text + "\n"}
+		if size > 0 {
+			body := text[strings.Index(text, "\n\n")+2 : strings.Index(text, "\n=")]
+			rewrapped := strings.Replace(body, "\n", "", -1)
+			if len(rewrapped) > 76 {
+				rewrapped = rewrapped[:76] + "\n" + rewrapped[76:]
+			}
+			copies = append(copies, strings.Replace(text, body, rewrapped, 1))
+		}
+		for _, copy := range copies {
+			result, headers, err := unarmor(copy)
+			if err != nil {
+				t.Fatalf("Error reading armor of %d bytes: %v\n%q", size, err, copy)
+			}
+			if !bytes.Equal(result, data) || headers["Mode"] != "rsa" || headers["Comment"] != "test" {
+				t.Fatalf("armor of %d bytes not decoded: %v", size, headers)
+			}
+		}
+		if size == 0 {
+			continue
+		}
+		//altered data, truncated message
+		altered := []byte(text)
+		i := strings.Index(text, "\n\n") + 2
+		if altered[i] == 'A' {
+			altered[i] = 'B'
+		} else {
+			altered[i] = 'A'
+		}
+		if _, _, err := unarmor(string(altered)); err == nil {
+			t.Fatalf("altered armor should fail")
+		}
+		if _, _, err := unarmor(text[:len(text)-30]); err == nil {
+			t.Fatalf("truncated armor should fail")
+		}
+	}
+	if _, _, err := unarmor("not armored"); err == nil {
+		t.Fatalf("missing BEGIN line should fail")
+	}
+}
+
+func TestArmoredFile(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	data := make([]byte, 5000)
+	rand.Read(data)
+	for _, mode := range []string{rsa.ModeRSA, rsa.ModeOAEP, rsa.ModeHybrid} {
+		encrypted := encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Mode: mode, Armor: true, Compression: rsa.CompressionAuto})
+		if !bytes.HasPrefix(encrypted, []byte("-----BEGIN CIPHER MESSAGE-----\nMode: "+mode+"\n\n")) {
+			t.Fatalf("%s mode: armored file expected:\n%s", mode, encrypted[:100])
+		}
+		for _, b := range encrypted {
+			if b != '\n' && (b < 32 || b > 126) {
+				t.Fatalf("%s mode: armored file should be printable", mode)
+			}
+		}
+		//the armored file is detected
+		dir := t.TempDir()
+		file := filepath.Join(dir, "armored")
+		if err := ioutil.WriteFile(file, bytes.Replace(encrypted, []byte("\n"), []byte("\r\n"), -1), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := rsa.DecryptFile(file, filepath.Join(dir, "decrypted"), path+".key"); err != nil {
+			t.Fatalf("%s mode: armored file with CRLF not decrypted: %v", mode, err)
+		}
+	}
+}
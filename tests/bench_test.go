@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"testing"
+)
+
+// key sizes of the README, the public exponent of cipher keys has a quarter of the key size
+var benchKeySizes = []int{2048, 4096, 8192, 16384, 32768}
+
+func randomOdd(t testing.TB, size int) *big.Int {
+	n, err := rand.Int(rand.Reader, big.NewInt(0).Lsh(big.NewInt(1), uint(size)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n.SetBit(n.SetBit(n, size-1, 1), 0, 1)
+}
+
+func TestPowModuloWindow(t *testing.T) {
+	for _, size := range []int{8, 64, 65, 1024, 2048} {
+		for _, eSize := range []int{1, 2, 17, 30, 100, 300, 1000} {
+			m := randomOdd(t, size)
+			e := randomOdd(t, eSize)
+			b, _ := rand.Int(rand.Reader, m)
+			expected := big.NewInt(0).Exp(b, e, m)
+			if r := rsa.PowModuloWindow(b, e, m); r.Cmp(expected) != 0 {
+				t.Fatalf("PowModuloWindow(%x, %x, %x) = %x, expected %x", b, e, m, r, expected)
+			}
+		}
+	}
+	publicKey, _, err := rsa.CreateRSAKey(1024, false, false)
+	if err != nil {
+		t.Fatalf("Error on RSA Key generation: %v\n", err)
+	}
+	msg := []byte("public exponentiation")
+	var expected []byte
+	for _, name := range []string{"binary", "window", "big", "auto"} {
+		algorithm, err := rsa.ParseExpAlgorithm(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKey.SetExpAlgorithm(algorithm)
+		c, err := publicKey.Encrypt(msg, 128)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected == nil {
+			expected = c
+		} else if !bytes.Equal(c, expected) {
+			t.Fatalf("Encrypt with %s exponentiation doesn't match binary", name)
+		}
+	}
+	if _, err := rsa.ParseExpAlgorithm("fast"); err == nil {
+		t.Fatalf("unknown algorithm should be rejected")
+	}
+}
+
+func BenchmarkPublicExp(b *testing.B) {
+	algorithms := map[string]func(*big.Int, *big.Int, *big.Int) *big.Int{
+		"binary": rsa.PowModulo,
+		"window": rsa.PowModuloWindow,
+		"big":    func(x, e, m *big.Int) *big.Int { return big.NewInt(0).Exp(x, e, m) },
+	}
+	for _, size := range benchKeySizes {
+		m := randomOdd(b, size)
+		e := randomOdd(b, size/4)
+		x, _ := rand.Int(rand.Reader, m)
+		for _, name := range []string{"binary", "window", "big"} {
+			exp := algorithms[name]
+			b.Run(fmt.Sprintf("%d/%s", size, name), func(b *testing.B) {
+				b.SetBytes(int64(size/8 - 1))
+				for i := 0; i < b.N; i++ {
+					exp(x, e, m)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecrypt(b *testing.B) {
+	_, privateKey, err := rsa.CreateRSAKeyWithExponent(2048, 65537, false, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	c := make([]byte, 255)
+	rand.Read(c)
+	for _, blinding := range []bool{true, false} {
+		b.Run(fmt.Sprintf("blinding=%t", blinding), func(b *testing.B) {
+			privateKey.SetBlinding(blinding)
+			for i := 0; i < b.N; i++ {
+				privateKey.DecryptRaw(c, 256)
+			}
+		})
+	}
+}
+
+// go test ./tests -run XXX -bench Workers, should scale with the number of cores
+func BenchmarkWorkers(b *testing.B) {
+	_, privateKey, err := rsa.CreateRSAKeyWithExponent(2048, 65537, false, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	publicKey := privateKey.PublicKey()
+	data := make([]byte, 64*1024)
+	rand.Read(data)
+	encrypted := &bytes.Buffer{}
+	w, _ := rsa.NewEncryptWriter(encrypted, publicKey)
+	w.Write(data)
+	w.Close()
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("decrypt/workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				r, _ := rsa.NewDecryptReaderContext(context.Background(), bytes.NewReader(encrypted.Bytes()), privateKey, &rsa.DecryptOptions{Workers: workers})
+				if _, err := io.Copy(ioutil.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
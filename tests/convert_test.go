@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"crypto/rand"
+	gorsa "crypto/rsa"
+	"github.com/freignat91/cipher/rsa"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func checkSameCryptoKeys(t *testing.T, k1 *gorsa.PrivateKey, k2 *gorsa.PrivateKey) {
+	if !k1.Equal(k2) {
+		t.Fatalf("keys are not equal")
+	}
+	if len(k1.Primes) != len(k2.Primes) {
+		t.Fatalf("number of primes not equal: %d != %d", len(k1.Primes), len(k2.Primes))
+	}
+	values := [][2]*big.Int{
+		{k1.Precomputed.Dp, k2.Precomputed.Dp},
+		{k1.Precomputed.Dq, k2.Precomputed.Dq},
+		{k1.Precomputed.Qinv, k2.Precomputed.Qinv},
+	}
+	for i, crt := range k1.Precomputed.CRTValues {
+		values = append(values, [2]*big.Int{crt.Exp, k2.Precomputed.CRTValues[i].Exp}, [2]*big.Int{crt.Coeff, k2.Precomputed.CRTValues[i].Coeff}, [2]*big.Int{crt.R, k2.Precomputed.CRTValues[i].R})
+	}
+	for i, value := range values {
+		if value[0].Cmp(value[1]) != 0 {
+			t.Fatalf("precomputed value %d not equal: %x != %x", i, value[0], value[1])
+		}
+	}
+}
+
+func TestCryptoKeyConversion(t *testing.T) {
+	goKey, err := gorsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiPrimeKey, err := gorsa.GenerateMultiPrimeKey(rand.Reader, 3, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []*gorsa.PrivateKey{goKey, multiPrimeKey} {
+		privateKey, err := rsa.FromCryptoPrivateKey(key)
+		if err != nil {
+			t.Fatalf("Error on FromCryptoPrivateKey: %v\n", err)
+		}
+		key2, err := privateKey.ToCryptoPrivateKey()
+		if err != nil {
+			t.Fatalf("Error on ToCryptoPrivateKey: %v\n", err)
+		}
+		checkSameCryptoKeys(t, key, key2)
+		publicKey, err := rsa.FromCryptoPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatalf("Error on FromCryptoPublicKey: %v\n", err)
+		}
+		pub2, err := publicKey.ToCryptoPublicKey()
+		if err != nil || !key.PublicKey.Equal(pub2) {
+			t.Fatalf("Error on ToCryptoPublicKey: %v\n", err)
+		}
+		msg := []byte("converted")
+		c, err := gorsa.EncryptPKCS1v15(rand.Reader, pub2, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d, err := privateKey.DecryptPKCS1v15(c); err != nil || string(d) != string(msg) {
+			t.Fatalf("Error decrypting with a converted key: %v\n", err)
+		}
+	}
+}
+
+func TestCipherKeyConversion(t *testing.T) {
+	publicKey, privateKey, err := rsa.CreateRSAKeyWithExponent(1024, 65537, false, false)
+	if err != nil {
+		t.Fatalf("Error on RSA Key generation: %v\n", err)
+	}
+	key, err := privateKey.ToCryptoPrivateKey()
+	if err != nil {
+		t.Fatalf("Error on ToCryptoPrivateKey: %v\n", err)
+	}
+	if len(key.Primes) != 2 {
+		t.Fatalf("primes should be kept")
+	}
+	//primes are saved with the key
+	path := filepath.Join(t.TempDir(), "key")
+	if err := rsa.SaveKeys(path, publicKey, privateKey); err != nil {
+		t.Fatal(err)
+	}
+	_, privateKey2, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := privateKey2.ToCryptoPrivateKey()
+	if err != nil {
+		t.Fatalf("Error on ToCryptoPrivateKey after reload: %v\n", err)
+	}
+	checkSameCryptoKeys(t, key, key2)
+
+	//primes are recovered for keys saved without them
+	goKey, path := createGoKey(t, 2048)
+	_, legacyKey, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err = legacyKey.ToCryptoPrivateKey()
+	if err != nil {
+		t.Fatalf("Error on ToCryptoPrivateKey without primes: %v\n", err)
+	}
+	p, q := key.Primes[0], key.Primes[1]
+	if p.Cmp(goKey.Primes[0]) != 0 {
+		p, q = q, p
+	}
+	if key.D.Cmp(goKey.D) != 0 || p.Cmp(goKey.Primes[0]) != 0 || q.Cmp(goKey.Primes[1]) != 0 {
+		t.Fatalf("recovered primes are not the original ones")
+	}
+
+	//crypto/rsa exponent is an int
+	publicKey, privateKey, err = rsa.CreateRSAKey(1024, false, false)
+	if err != nil {
+		t.Fatalf("Error on RSA Key generation: %v\n", err)
+	}
+	if _, err := publicKey.ToCryptoPublicKey(); err == nil || !strings.Contains(err.Error(), "exponent too large") {
+		t.Fatalf("ToCryptoPublicKey should reject a large exponent: %v\n", err)
+	}
+	if _, err := privateKey.ToCryptoPrivateKey(); err == nil {
+		t.Fatalf("ToCryptoPrivateKey should reject a large exponent")
+	}
+}
+
+func TestCryptoKeyConversionRejected(t *testing.T) {
+	goKey, err := gorsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//a wrong CRT value would give signatures revealing a prime factor
+	tampered := *goKey
+	tampered.Precomputed.Dp = big.NewInt(0).Add(goKey.Precomputed.Dp, big.NewInt(2))
+	if _, err := rsa.FromCryptoPrivateKey(&tampered); err == nil {
+		t.Fatalf("a key with a tampered Dp should be rejected")
+	}
+	invalid := *goKey
+	invalid.D = big.NewInt(0).Add(goKey.D, big.NewInt(2))
+	if _, err := rsa.FromCryptoPrivateKey(&invalid); err == nil || !strings.Contains(err.Error(), "invalid private key") {
+		t.Fatalf("a key crypto/rsa rejects should be rejected: %v", err)
+	}
+	//crypto/rsa validates the keys without primes with the primes recovered from n, e and d
+	invalid = gorsa.PrivateKey{PublicKey: goKey.PublicKey, D: invalid.D}
+	if _, err := rsa.FromCryptoPrivateKey(&invalid); err == nil {
+		t.Fatalf("a key without primes and a wrong d should be rejected")
+	}
+	if _, err := rsa.FromCryptoPrivateKey(&gorsa.PrivateKey{PublicKey: goKey.PublicKey, D: goKey.D}); err != nil {
+		t.Fatalf("a key without primes should be accepted: %v", err)
+	}
+	if _, err := rsa.FromCryptoPrivateKey(nil); err == nil {
+		t.Fatalf("a nil key should be rejected")
+	}
+	if _, err := rsa.FromCryptoPrivateKey(&gorsa.PrivateKey{D: goKey.D}); err == nil {
+		t.Fatalf("a key without modulus should be rejected")
+	}
+	if _, err := rsa.FromCryptoPrivateKey(goKey); err != nil {
+		t.Fatalf("the original key should be accepted: %v", err)
+	}
+}
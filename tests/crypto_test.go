@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	gorsa "crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/freignat91/cipher/rsa"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestDecrypterGoInterop(t *testing.T) {
+	goKey, path := createGoKey(t, 2048)
+	publicKey, privateKey, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatalf("Error reading keys: %v\n", err)
+	}
+	var decrypter crypto.Decrypter = privateKey
+	msg := []byte("file key")
+	label := []byte("label")
+	c, err := gorsa.EncryptOAEP(sha256.New(), rand.Reader, &goKey.PublicKey, msg, label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := decrypter.Decrypt(nil, c, &gorsa.OAEPOptions{Hash: crypto.SHA256, Label: label})
+	if err != nil || !bytes.Equal(d, msg) {
+		t.Fatalf("Error decrypting crypto/rsa OAEP ciphertext: %v\n", err)
+	}
+	if _, err := decrypter.Decrypt(nil, c, &gorsa.OAEPOptions{Hash: crypto.SHA256}); err == nil {
+		t.Fatalf("OAEP decryption should fail with another label")
+	}
+	if c, err = publicKey.EncryptOAEP(crypto.SHA256, msg, label); err != nil {
+		t.Fatal(err)
+	}
+	if d, err = gorsa.DecryptOAEP(sha256.New(), nil, goKey, c, label); err != nil || !bytes.Equal(d, msg) {
+		t.Fatalf("crypto/rsa can't decrypt OAEP ciphertext: %v\n", err)
+	}
+
+	if c, err = gorsa.EncryptPKCS1v15(rand.Reader, &goKey.PublicKey, msg); err != nil {
+		t.Fatal(err)
+	}
+	d, err = decrypter.Decrypt(nil, c, &gorsa.PKCS1v15DecryptOptions{SessionKeyLen: len(msg)})
+	if err != nil || !bytes.Equal(d, msg) {
+		t.Fatalf("Error decrypting PKCS#1 v1.5 session key: %v\n", err)
+	}
+	d, err = decrypter.Decrypt(nil, c, &gorsa.PKCS1v15DecryptOptions{SessionKeyLen: 16})
+	if err != nil || len(d) != 16 {
+		t.Fatalf("A random session key should be returned on length mismatch: %v\n", err)
+	}
+}
+
+func TestSignerTLS(t *testing.T) {
+	_, privateKey, err := rsa.CreateRSAKeyWithExponent(2048, 65537, false, false)
+	if err != nil {
+		t.Fatalf("Error on RSA Key generation: %v\n", err)
+	}
+	var signer crypto.Signer = privateKey
+	if _, ok := signer.Public().(*gorsa.PublicKey); !ok {
+		t.Fatalf("Public should return a *crypto/rsa.PublicKey, got %T", signer.Public())
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "cipher"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v\n", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: privateKey}},
+			MinVersion:   version,
+			MaxVersion:   version,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			io.Copy(conn, conn)
+		}()
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: roots, ServerName: "localhost"})
+		if err != nil {
+			listener.Close()
+			t.Fatalf("TLS handshake failed (version %x): %v\n", version, err)
+		}
+		msg := []byte("ping")
+		conn.Write(msg)
+		reply := make([]byte, len(msg))
+		if _, err := io.ReadFull(conn, reply); err != nil || !bytes.Equal(reply, msg) {
+			t.Fatalf("Error reading TLS reply: %v\n", err)
+		}
+		conn.Close()
+		listener.Close()
+	}
+}
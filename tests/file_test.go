@@ -0,0 +1,507 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/freignat91/cipher/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// encrypts data with options and decrypts it, returns the encrypted file
+func encryptDecryptFile(t *testing.T, keyPath string, data []byte, options *rsa.EncryptOptions) []byte {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	encrypted := filepath.Join(dir, "encrypted")
+	decrypted := filepath.Join(dir, "decrypted")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.EncryptFileWithOptions(source, encrypted, keyPath+".pub", options); err != nil {
+		t.Fatalf("Error on EncryptFile: %v\n", err)
+	}
+	if err := rsa.DecryptFile(encrypted, decrypted, keyPath+".key"); err != nil {
+		t.Fatalf("Error on DecryptFile: %v\n", err)
+	}
+	result, err := ioutil.ReadFile(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, data) {
+		t.Fatalf("decrypted file differs from the source (%d bytes, %d expected)", len(result), len(data))
+	}
+	encryptedData, err := ioutil.ReadFile(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encryptedData
+}
+
+func TestEncryptFileModes(t *testing.T) {
+	_, path := createGoKey(t, 2048)
+	chunk := 64 * 1024
+	for _, size := range []int{0, 1, 254, 255, 256, chunk - 1, chunk, chunk + 1, 3*chunk + 5} {
+		data := make([]byte, size)
+		rand.Read(data)
+		encryptDecryptFile(t, path, data, nil)
+		encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Mode: rsa.ModeOAEP})
+		encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Mode: rsa.ModeHybrid})
+	}
+}
+
+func TestFilePermissions(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	dir := t.TempDir()
+	//the files written have the permissions of os.Create, 0666 minus the umask
+	reference, err := os.Create(filepath.Join(dir, "reference"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reference.Close()
+	info, err := os.Stat(reference.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "source")
+	if err := ioutil.WriteFile(source, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, decrypted := filepath.Join(dir, "encrypted"), filepath.Join(dir, "decrypted")
+	if err := rsa.EncryptFile(source, encrypted, path+".pub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.DecryptFile(encrypted, decrypted, path+".key"); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{encrypted, decrypted} {
+		written, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written.Mode() != info.Mode() {
+			t.Fatalf("%s: mode %v, %v expected", file, written.Mode(), info.Mode())
+		}
+	}
+}
+
+func TestHybridTampering(t *testing.T) {
+	_, path := createGoKey(t, 2048)
+	data := make([]byte, 200000)
+	rand.Read(data)
+	encrypted := encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Mode: rsa.ModeHybrid})
+	dir := t.TempDir()
+	flipped := append([]byte(nil), encrypted...)
+	flipped[len(flipped)-100] ^= 1
+	for name, altered := range map[string][]byte{
+		"body byte":      flipped,
+		"header byte":    bytes.Replace(encrypted, []byte(`"chunkSize":65536`), []byte(`"chunkSize":65537`), 1),
+		"truncated":      encrypted[:len(encrypted)-1000],
+		"last chunk cut": encrypted[:len(encrypted)-(len(data)%(64*1024)+16)],
+	} {
+		file := filepath.Join(dir, "altered")
+		if err := ioutil.WriteFile(file, altered, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := rsa.DecryptFile(file, filepath.Join(dir, "decrypted"), path+".key"); err == nil {
+			t.Fatalf("%s: decryption of an altered file should fail", name)
+		}
+	}
+}
+
+func TestMultiRecipient(t *testing.T) {
+	var keys []string
+	for i := 0; i < 4; i++ {
+		_, path := createGoKey(t, 2048)
+		keys = append(keys, path)
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	encrypted := filepath.Join(dir, "encrypted")
+	decrypted := filepath.Join(dir, "decrypted")
+	data := make([]byte, 100000)
+	rand.Read(data)
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.EncryptFileWithOptions(source, encrypted, keys[0]+".pub", &rsa.EncryptOptions{Recipients: []string{keys[1] + ".pub", keys[2] + ".pub"}}); err != nil {
+		t.Fatalf("Error on EncryptFile: %v\n", err)
+	}
+	checkDecrypt := func(i int, ok bool) {
+		err := rsa.DecryptFile(encrypted, decrypted, keys[i]+".key")
+		if !ok {
+			if err == nil {
+				t.Fatalf("key %d shouldn't decrypt the file", i)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Error on DecryptFile: %v\n", err)
+		}
+		if result, _ := ioutil.ReadFile(decrypted); !bytes.Equal(result, data) {
+			t.Fatalf("decrypted file differs from the source")
+		}
+	}
+	checkDecrypt(0, true)
+	checkDecrypt(1, true)
+	checkDecrypt(2, true)
+	checkDecrypt(3, false)
+	before, _ := ioutil.ReadFile(encrypted)
+	if err := os.Chmod(encrypted, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rsa.AddRecipients(encrypted, keys[3]+".key", keys[0]+".pub"); err == nil {
+		t.Fatalf("a key which isn't a recipient shouldn't add recipients")
+	}
+	if err := rsa.AddRecipients(encrypted, keys[1]+".key", keys[3]+".pub"); err != nil {
+		t.Fatalf("Error on AddRecipients: %v\n", err)
+	}
+	checkDecrypt(3, true)
+	publicKey, err := rsa.GetPublicKey(keys[1] + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.RemoveRecipients(encrypted, keys[0]+".pub", publicKey.Fingerprint()); err != nil {
+		t.Fatalf("Error on RemoveRecipients: %v\n", err)
+	}
+	checkDecrypt(0, false)
+	checkDecrypt(1, false)
+	checkDecrypt(2, true)
+	checkDecrypt(3, true)
+	if err := rsa.RemoveRecipients(encrypted, keys[2]+".pub", keys[3]+".pub"); err == nil {
+		t.Fatalf("the last recipient shouldn't be removed")
+	}
+	if info, err := os.Stat(encrypted); err != nil || info.Mode().Perm() != 0640 {
+		t.Fatalf("the permissions of the file should be kept: %v", err)
+	}
+	//the body is not encrypted again
+	after, _ := ioutil.ReadFile(encrypted)
+	size := len(data) + 2*16
+	if !bytes.Equal(before[len(before)-size:], after[len(after)-size:]) {
+		t.Fatalf("the body changed")
+	}
+}
+
+// encrypts data in the headerless format of the previous versions
+func writeLegacyFile(t *testing.T, path string, publicKey *rsa.PublicKey, data []byte) {
+	bufferSize := publicKey.GetRSAKeySize()/8 - 1
+	encrypted := []byte{}
+	lastN := 0
+	for len(data) > 0 {
+		n := bufferSize
+		if n > len(data) {
+			n = len(data)
+		}
+		block, err := publicKey.Encrypt(data[:n], bufferSize+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted = append(encrypted, block...)
+		data = data[n:]
+		lastN = n
+	}
+	encrypted = append(encrypted, byte(lastN%256), byte(lastN/256))
+	if err := ioutil.WriteFile(path, encrypted, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	_, path := createGoKey(t, 2048)
+	_, otherPath := createGoKey(t, 2048)
+	dir := t.TempDir()
+	data := make([]byte, 1000)
+	rand.Read(data)
+	for _, mode := range []string{rsa.ModeRSA, rsa.ModeOAEP, rsa.ModeHybrid} {
+		encrypted := encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Mode: mode})
+		if !bytes.HasPrefix(encrypted, []byte("CIPHER\x01")) || !bytes.Contains(encrypted, []byte(`"mode":"`+mode+`"`)) {
+			t.Fatalf("missing file header")
+		}
+		file := filepath.Join(dir, "encrypted")
+		if err := ioutil.WriteFile(file, encrypted, 0600); err != nil {
+			t.Fatal(err)
+		}
+		//a wrong key is rejected before writing anything
+		target := filepath.Join(dir, "decrypted-"+mode)
+		err := rsa.DecryptFile(file, target, otherPath+".key")
+		if err == nil || !strings.Contains(err.Error(), "not for this key") && !strings.Contains(err.Error(), "not encrypted for this key") {
+			t.Fatalf("decryption with another key should fail with a clear error: %v", err)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Fatalf("nothing should be written with a wrong key")
+		}
+		//the original length is checked
+		altered := bytes.Replace(encrypted, []byte(`"length":1000`), []byte(`"length":1001`), 1)
+		if err := ioutil.WriteFile(file, altered, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := rsa.DecryptFile(file, target, path+".key"); err == nil {
+			t.Fatalf("decryption should fail when the length doesn't match")
+		}
+	}
+
+	//files written by the previous versions
+	publicKey, err := rsa.GetPublicKey(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 1, 255, 256, 1000} {
+		file := filepath.Join(dir, "legacy")
+		writeLegacyFile(t, file, publicKey, data[:size])
+		//they can't be authenticated, they have to be accepted explicitly
+		if err := rsa.DecryptFile(file, filepath.Join(dir, "decrypted"), path+".key"); err != rsa.ErrUnauthenticated {
+			t.Fatalf("a legacy file should be refused by default: %v", err)
+		}
+		options := &rsa.DecryptOptions{AllowUnauthenticated: true}
+		if err := rsa.DecryptFileWithOptions(file, filepath.Join(dir, "decrypted"), path+".key", options); err != nil {
+			t.Fatalf("Error decrypting a legacy file: %v\n", err)
+		}
+		if result, _ := ioutil.ReadFile(filepath.Join(dir, "decrypted")); !bytes.Equal(result, data[:size]) {
+			t.Fatalf("legacy file of %d bytes not decrypted", size)
+		}
+	}
+}
+
+func TestRSATampering(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	data := make([]byte, 1000)
+	rand.Read(data)
+	encrypted := encryptDecryptFile(t, path, data, nil)
+	dir := t.TempDir()
+	size := 1024 / 8
+	//8 blocks of 127 bytes, then the trailer, the block tree (a single leaf and its tag) and the tag
+	body := len(encrypted) - 8*size - 2 - 64 - 32
+	block := func(i int) []byte {
+		return encrypted[body+i*size : body+(i+1)*size]
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	end := encrypted[body+8*size:]
+	header := encrypted[:body]
+	blocks := encrypted[body : body+8*size]
+	tampered := map[string][]byte{
+		"swapped blocks":     join(header, block(1), block(0), encrypted[body+2*size:]),
+		"dropped block":      join(header, blocks[size:], end),
+		"dropped last":       join(header, blocks[:7*size], end),
+		"duplicated block":   join(header, block(0), blocks, end),
+		"changed trailer":    join(header, blocks, []byte{end[0] ^ 1}, end[1:]),
+		"changed tree":       join(header, blocks, end[:2], []byte{end[2] ^ 1}, end[3:]),
+		"truncated":          encrypted[:len(encrypted)-1],
+		"no tag":             encrypted[:len(encrypted)-32],
+		"flipped bit":        join(header, blocks[:100], []byte{blocks[100] ^ 1}, blocks[101:], end),
+		"changed length":     bytes.Replace(encrypted, []byte(`"length":1000`), []byte(`"length":999`), 1),
+		"header without mac": bytes.Replace(encrypted, []byte(`"mac":"hmac-sha256"`), []byte(`"mac":""`), 1),
+	}
+	for name, altered := range tampered {
+		file := filepath.Join(dir, "tampered")
+		if err := ioutil.WriteFile(file, altered, 0600); err != nil {
+			t.Fatal(err)
+		}
+		for _, workers := range []int{1, 4} {
+			target := filepath.Join(dir, "decrypted")
+			err := rsa.DecryptFileWithOptions(file, target, path+".key", &rsa.DecryptOptions{Workers: workers})
+			if err == nil {
+				t.Fatalf("%s: decryption should fail", name)
+			}
+			//no partial plaintext
+			if files, _ := filepath.Glob(filepath.Join(dir, "decrypted*")); len(files) > 0 {
+				t.Fatalf("%s: %v left after a failed decryption", name, files)
+			}
+		}
+	}
+}
+
+// replaces the MAC key of a rsa mode file with a new key encapsulated with the public key and computes the tag
+// again over the header, the encrypted blocks, the trailer and the tree, as anybody could if the tag didn't cover
+// the data. The file has blocks blocks of size bytes, forgeTree returns the tree written with the new key for the
+// new header and the encrypted blocks, the tree is kept if it is nil
+func forgeMAC(t *testing.T, encrypted []byte, publicKey *rsa.PublicKey, blocks int, size int, forgeTree func(key []byte, header []byte, blocks []byte) []byte) []byte {
+	body := 11 + int(binary.BigEndian.Uint32(encrypted[7:11]))
+	var header struct {
+		Length int64  `json:"length"`
+		MACKey []byte `json:"macKey"`
+	}
+	if err := json.Unmarshal(encrypted[11:body], &header); err != nil {
+		t.Fatal(err)
+	}
+	key, encapsulation, err := publicKey.Encapsulate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Replace(encrypted[11:body], []byte(base64.StdEncoding.EncodeToString(header.MACKey)), []byte(base64.StdEncoding.EncodeToString(encapsulation)), 1)
+	forged := append([]byte(nil), encrypted[:7]...)
+	forged = append(forged, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(forged[7:], uint32(len(data)))
+	forged = append(forged, data...)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(forged)
+	end := body + blocks*size
+	pieces := [][]byte{}
+	for i := 0; i < blocks; i++ {
+		pieces = append(pieces, encrypted[body+i*size:body+(i+1)*size])
+	}
+	pieces = append(pieces, encrypted[end:end+2])
+	tree := encrypted[end+2 : len(encrypted)-32]
+	if forgeTree != nil {
+		tree = forgeTree(key, forged, encrypted[body:end])
+	}
+	if len(tree) > 0 {
+		pieces = append(pieces, tree)
+	}
+	seq := make([]byte, 8)
+	for i, piece := range pieces {
+		binary.BigEndian.PutUint64(seq, uint64(i))
+		mac.Write(seq)
+		mac.Write(piece)
+	}
+	binary.BigEndian.PutUint64(seq, uint64(header.Length))
+	mac.Write(seq)
+	forged = append(forged, encrypted[body:end+2]...)
+	forged = append(forged, tree...)
+	return mac.Sum(forged)
+}
+
+func TestForgedMAC(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	publicKey, err := rsa.GetPublicKey(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1000)
+	rand.Read(data)
+	dir := t.TempDir()
+	size := 1024 / 8
+	//blocks of 127 bytes in rsa mode, 62 bytes in rsa-oaep mode
+	for mode, blocks := range map[string]int{rsa.ModeRSA: 8, rsa.ModeOAEP: 17} {
+		encrypted := encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Mode: mode})
+		body := len(encrypted) - blocks*size - 2 - 64 - 32
+		swapped := append([]byte(nil), encrypted[:body]...)
+		swapped = append(swapped, encrypted[body+size:body+2*size]...)
+		swapped = append(swapped, encrypted[body:body+size]...)
+		swapped = append(swapped, encrypted[body+2*size:]...)
+		for name, altered := range map[string][]byte{"swapped blocks": swapped, "swapped blocks with a new MAC key": forgeMAC(t, swapped, publicKey, blocks, size, nil)} {
+			file := filepath.Join(dir, "forged")
+			if err := ioutil.WriteFile(file, altered, 0600); err != nil {
+				t.Fatal(err)
+			}
+			for _, workers := range []int{1, 4} {
+				err := rsa.DecryptFileWithOptions(file, filepath.Join(dir, "decrypted"), path+".key", &rsa.DecryptOptions{Workers: workers})
+				if err != rsa.ErrAuthentication {
+					t.Fatalf("%s: %s should fail with ErrAuthentication: %v", mode, name, err)
+				}
+			}
+		}
+	}
+}
+
+// counts the encrypted blocks of the body seen before
+func repeatedBlocks(encrypted []byte, bodySize int, size int) int {
+	seen := map[string]bool{}
+	repeated := 0
+	body := encrypted[len(encrypted)-bodySize:]
+	for i := 0; i+size <= len(body); i += size {
+		if seen[string(body[i:i+size])] {
+			repeated++
+		}
+		seen[string(body[i:i+size])] = true
+	}
+	return repeated
+}
+
+func TestOAEPMode(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	size := 1024 / 8
+	//structured data: the same block repeated
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+	rsaFile := encryptDecryptFile(t, path, data, nil)
+	blocks := (len(data) + size - 2) / (size - 1)
+	//the blocks are followed by the trailer, the block tree and the tag
+	end := 2 + 64 + 32
+	if repeatedBlocks(rsaFile, blocks*size+end, size) == 0 {
+		t.Fatalf("the rsa mode should give equal encrypted blocks for equal blocks")
+	}
+	oaepFile := encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Mode: rsa.ModeOAEP})
+	dataSize := size - 2*32 - 2
+	blocks = (len(data) + dataSize - 1) / dataSize
+	if repeated := repeatedBlocks(oaepFile, blocks*size+end, size); repeated != 0 {
+		t.Fatalf("%d repeated encrypted blocks in rsa-oaep mode", repeated)
+	}
+	//two encryptions of the same file differ
+	if other := encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Mode: rsa.ModeOAEP}); bytes.Equal(other[len(other)-blocks*size:], oaepFile[len(oaepFile)-blocks*size:]) {
+		t.Fatalf("two encryptions in rsa-oaep mode should differ")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	publicKey, privateKey, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := bytes.Repeat([]byte("compressible text, compressible text. "), 5000)
+	random := make([]byte, 100000)
+	rand.Read(random)
+	gzipped := &bytes.Buffer{}
+	zw := gzip.NewWriter(gzipped)
+	zw.Write(text)
+	zw.Close()
+	compressed := []byte(`"compression":"gzip"`)
+	for _, mode := range []string{rsa.ModeRSA, rsa.ModeOAEP, rsa.ModeHybrid} {
+		encrypted := encryptDecryptFile(t, path, text, &rsa.EncryptOptions{Mode: mode, Compression: rsa.CompressionGzip})
+		if !bytes.Contains(encrypted, compressed) || len(encrypted) > len(text)/10 {
+			t.Fatalf("%s mode: %d bytes compressed to %d", mode, len(text), len(encrypted))
+		}
+		for _, data := range [][]byte{text, random, gzipped.Bytes(), text[:100], {}} {
+			encrypted := encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Mode: mode, Compression: rsa.CompressionAuto})
+			if expected := bytes.Equal(data, text); bytes.Contains(encrypted, compressed) != expected {
+				t.Fatalf("%s mode: auto compression of %d bytes should be %t", mode, len(data), expected)
+			}
+		}
+		//auto compression of a stream, decided on the first data
+		for _, data := range [][]byte{text, random, text[:1000]} {
+			encrypted := &bytes.Buffer{}
+			w, err := rsa.NewEncryptWriterWithOptions(encrypted, []*rsa.PublicKey{publicKey}, &rsa.EncryptOptions{Mode: mode, Compression: rsa.CompressionAuto})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < len(data); i += 1000 {
+				w.Write(data[i : i+1000])
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(encrypted.Bytes(), compressed) == bytes.Equal(data, random) {
+				t.Fatalf("%s mode: wrong auto compression of a stream of %d bytes", mode, len(data))
+			}
+			r, err := rsa.NewDecryptReader(bytes.NewReader(encrypted.Bytes()), privateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(result, data) {
+				t.Fatalf("%s mode: compressed stream not decrypted: %v", mode, err)
+			}
+		}
+	}
+	zstd := []byte(`"compression":"zstd"`)
+	for _, mode := range []string{rsa.ModeRSA, rsa.ModeHybrid} {
+		for _, data := range [][]byte{text, random, {}} {
+			encrypted := encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Mode: mode, Compression: rsa.CompressionZstd})
+			if !bytes.Contains(encrypted, zstd) || (bytes.Equal(data, text) && len(encrypted) > len(text)/10) {
+				t.Fatalf("%s mode: %d bytes compressed with zstd to %d", mode, len(data), len(encrypted))
+			}
+		}
+	}
+	if err := rsa.EncryptFileWithOptions(path+".pub", filepath.Join(t.TempDir(), "encrypted"), path+".pub", &rsa.EncryptOptions{Compression: "lz4"}); err == nil {
+		t.Fatalf("an unknown compression should be refused")
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"crypto/rand"
+	"github.com/freignat91/cipher/rsa"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspectFile(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	dir := t.TempDir()
+	data := make([]byte, 200000)
+	rand.Read(data)
+	source := filepath.Join(dir, "source")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, options := range []rsa.EncryptOptions{{}, {Mode: rsa.ModeOAEP}, {Mode: rsa.ModeHybrid}, {Armor: true}} {
+		encrypted := filepath.Join(dir, "encrypted")
+		if err := rsa.EncryptFileWithOptions(source, encrypted, path+".pub", &options); err != nil {
+			t.Fatal(err)
+		}
+		info, err := rsa.InspectFile(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mode := options.Mode
+		if mode == "" {
+			mode = rsa.ModeRSA
+		}
+		blocks := int64((len(data) + 126) / 127)
+		if mode == rsa.ModeOAEP {
+			blocks = int64((len(data) + 61) / 62)
+		} else if mode == rsa.ModeHybrid {
+			blocks = int64((len(data) + 65535) / 65536)
+		}
+		if info.Version != 1 || info.Mode != mode || info.Armored != options.Armor || info.Length != int64(len(data)) {
+			t.Fatalf("%+v: wrong file info %+v", options, info)
+		}
+		if info.Blocks != blocks || len(info.Fingerprints) != 1 || len(info.Problems) != 0 {
+			t.Fatalf("%+v: %d blocks, %d expected, fingerprints %v, problems %v", options, info.Blocks, blocks, info.Fingerprints, info.Problems)
+		}
+		if mode != rsa.ModeHybrid && (info.BlockSize != 128 || info.Tree == "") {
+			t.Fatalf("%+v: block size %d, tree %q", options, info.BlockSize, info.Tree)
+		}
+	}
+	encrypted := encryptDecryptFile(t, path, data, nil)
+	truncated := filepath.Join(dir, "truncated")
+	if err := ioutil.WriteFile(truncated, encrypted[:len(encrypted)-1000], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := rsa.InspectFile(truncated); err != nil || len(info.Problems) == 0 {
+		t.Fatalf("a truncated file should have a problem: %v", err)
+	}
+}
+
+// verifies the altered file and returns the *VerifyError
+func verifyAltered(t *testing.T, path string, altered []byte) *rsa.VerifyError {
+	file := filepath.Join(t.TempDir(), "altered")
+	if err := ioutil.WriteFile(file, altered, 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := rsa.VerifyEncryptedFile(file, path+".key", &rsa.DecryptOptions{Workers: 2})
+	verifyErr, ok := err.(*rsa.VerifyError)
+	if !ok {
+		t.Fatalf("verification of an altered file: %v, *VerifyError expected", err)
+	}
+	return verifyErr
+}
+
+func TestVerifyEncryptedFile(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	data := make([]byte, 200000)
+	rand.Read(data)
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := filepath.Join(dir, "encrypted")
+	if err := rsa.EncryptFile(source, encrypted, path+".pub"); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := rsa.VerifyEncryptedFile(encrypted, path+".key", nil)
+	if err != nil || blocks != int64((len(data)+126)/127) {
+		t.Fatalf("verification of %d blocks: %v", blocks, err)
+	}
+
+	//a block of the third leaf of 512 blocks: the whole segment is reported
+	rsaFile := encryptDecryptFile(t, path, data, nil)
+	size := 128
+	count := (len(data) + size - 2) / (size - 1)
+	body := len(rsaFile) - count*size - 2 - 7*32 - 32 - 32
+	rsaFile[body+1200*size+10] ^= 1
+	if err := verifyAltered(t, path, rsaFile); err.Block != 1024 || err.Count != 512 {
+		t.Fatalf("rsa: %v, blocks 1024 to 1535 expected", err)
+	}
+
+	hybrid := encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Mode: rsa.ModeHybrid})
+	hybrid[len(hybrid)-100] ^= 1
+	if err := verifyAltered(t, path, hybrid); err.Block != 3 || err.Count != 1 {
+		t.Fatalf("hybrid: %v, chunk 3 expected", err)
+	}
+
+	//without block tree the MAC covers the whole file
+	compressed := encryptDecryptFile(t, path, data, &rsa.EncryptOptions{Compression: rsa.CompressionGzip})
+	compressed[len(compressed)-200] ^= 1
+	if err := verifyAltered(t, path, compressed); err.Block != -1 {
+		t.Fatalf("compressed: %v, an unlocated error expected", err)
+	}
+}
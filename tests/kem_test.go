@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bytes"
+	"crypto"
+	gorsa "crypto/rsa"
+	"encoding/hex"
+	"github.com/freignat91/cipher/rsa"
+	"math/big"
+	"testing"
+)
+
+// 2048 bits key generated by openssl, expected values computed with an independent implementation of RSA-KEM
+const (
+	kemN = "c0e2144721016ad7d1d5a47ac290d5b406aed72a8c39dafe0525336ef730de55c7de4b59270cae8ebd80928d1034926287ec22e1976a79d7f22d5eadf4197137a59d2f303a880275cebe01b01edfb9fd5d7ecdc44642cb275fd276610cf4423fa9b9c729876befc135380df62b8d50a3143c2d8c1c3a268b93fd45e47fc58d5cd13645c9ff0c67f8f45b6cf580c8af3cff8de26ad104539d4853f7876c75af5843a16cf49c1860d5a84cbc22e4a7227dd3b329332773cb5d390956b7c4102737c91134d1a97e00877fecd8d6f64dd4bc705956fd064417d182b7a13a2c5dc78b3bb6f529a3ac90853366152e7a4dccec7d6973aab1c3db40dc8d3e9fa501c631"
+	kemD = "17ed3cbeb85c48a669a418a73af13ff5d480af4848771df9a3b89da82b62f083f94fc17357742bda0ed2315bc8a1b3bb91db299f6821a255fff79b1d635c1dbeb8d8a1aa7cc5fcba6d05e187b9314d56426b6a29e9b8c522b943209d583fc00816d668db77ae3807070b9a3457eab97e9cc9211f9699f4a3d3e61c5bbb72722842a5f9b7d24bba74157181c845439b95b9bdcac650d6ad341441e721304e5dcf5d403823b046a91070c7de2d006fa43e08a912b2deda7eb4ecbfffabdb59452639d1d3d679673f7afe27dbcff4b7cc3ddbc10e3a1923c3f80f780b5feeaaa58e51cff8c79075b9d3ca1306939cfeaab88de03622b917c437e534aa45c108901"
+)
+
+var kemVectors = []struct {
+	z, encapsulation, secret, secretSHA384 string
+}{
+	{
+		"00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+		"00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+		"c4f7c349edad19add86727af0c8a30dad30293f4ee79256bf1e3eb2cf335b99e",
+		"41ceec53e0b5d3901276e96640bd20b7c5b208120720ba7f0e3494bf3c3978cc5a9b21486319d2ff16f902793aaca1a86269268c9b715f74c349a708e5ca9c0c05b8d9bce5526eccc8cc8f3ade15d02b",
+	},
+	{
+		"00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000001",
+		"00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000001",
+		"4fd5a7ffa519b1d0d1d493aeae6c451bac24224252fbc46d03d4c3cdd2698c72",
+		"37346189e07bea9b39fa12e5b62126dd705958affac51813b49fc21c3d2d4d194a598a7fc54dfe4c4fb8fbc83155836f82f1d38776c7db3d16b04355035e11f22e50709f38ef51bacc407655e643179b",
+	},
+	{
+		"c0e2144721016ad7d1d5a47ac290d5b406aed72a8c39dafe0525336ef730de55c7de4b59270cae8ebd80928d1034926287ec22e1976a79d7f22d5eadf4197137a59d2f303a880275cebe01b01edfb9fd5d7ecdc44642cb275fd276610cf4423fa9b9c729876befc135380df62b8d50a3143c2d8c1c3a268b93fd45e47fc58d5cd13645c9ff0c67f8f45b6cf580c8af3cff8de26ad104539d4853f7876c75af5843a16cf49c1860d5a84cbc22e4a7227dd3b329332773cb5d390956b7c4102737c91134d1a97e00877fecd8d6f64dd4bc705956fd064417d182b7a13a2c5dc78b3bb6f529a3ac90853366152e7a4dccec7d6973aab1c3db40dc8d3e9fa501c630",
+		"c0e2144721016ad7d1d5a47ac290d5b406aed72a8c39dafe0525336ef730de55c7de4b59270cae8ebd80928d1034926287ec22e1976a79d7f22d5eadf4197137a59d2f303a880275cebe01b01edfb9fd5d7ecdc44642cb275fd276610cf4423fa9b9c729876befc135380df62b8d50a3143c2d8c1c3a268b93fd45e47fc58d5cd13645c9ff0c67f8f45b6cf580c8af3cff8de26ad104539d4853f7876c75af5843a16cf49c1860d5a84cbc22e4a7227dd3b329332773cb5d390956b7c4102737c91134d1a97e00877fecd8d6f64dd4bc705956fd064417d182b7a13a2c5dc78b3bb6f529a3ac90853366152e7a4dccec7d6973aab1c3db40dc8d3e9fa501c630",
+		"89e4f2b3b8f1a3b32e8045ae05d0756b312e2f06feb5a2c8eeb23c96c873806a",
+		"26efafcc8fce24a1a4464fb89352b4b8b3f8487e6289e44a1f2c980f43ae5a00d380241095f00c7a9407dd2b985cc0cac508b06e59da46f887d1e0fe217a93c87e2ff14c7f61e26beb962e70166db70a",
+	},
+	{
+		"5834920141fff1b7091ba4598b208d8a9de147e0475548bacec9ecf3755915135c923580d55b7dda9d78ecda2afaa772c3138f37f7670f947f4cbf856c3f29525834920141fff1b7091ba4598b208d8a9de147e0475548bacec9ecf3755915135c923580d55b7dda9d78ecda2afaa772c3138f37f7670f947f4cbf856c3f29525834920141fff1b7091ba4598b208d8a9de147e0475548bacec9ecf3755915135c923580d55b7dda9d78ecda2afaa772c3138f37f7670f947f4cbf856c3f29525834920141fff1b7091ba4598b208d8a9de147e0475548bacec9ecf3755915135c923580d55b7dda9d78ecda2afaa772c3138f37f7670f947f4cbf856c3f2952",
+		"93f625a8da5328f57ee66d7057f27ec06b78afa7d79bb81d4ef3b7a4dcba048d9c09773fdc58aa53749b4ae95a706bdf3e8f52eb9c2ca0fd517706437bd7324b7b7ed0547e999228260a311a90cd2dd21d37b0dee25cba00929bfd882636b1d91ffcfe259112313a8d719627bc8ff7d8946f5d12f4a8347af2ff0874e6e4ce62c3cb5a06dee9868a321f6b5f931ddfc8319110ad7f73b1cbc223d2d94f3f0fa21b16cb111f2be0a7124d58dbd85b293af8d57e53ca872a121461bda87ce789b79308bf645a112af1e24128d3c0dc0599e008b24abbe3b43717034614038b01445ceba62c0ff5a8f82d41f6ebec108464e73b1fe8da354cde195a075d818bae85",
+		"72ac2a2b40bf35c1b83099b51dd286fb11daa7a9a0a4e78f4aee1f7317e1415e",
+		"306c0bf3aecb26a842a93601f9c9d359001096435726429924b7f0d6974179bdb883b1b9de36fe64d584f176923862d49d0ab79673555228c2213e032a7fe4082d7e26b91678b7559780fe9905fba67e",
+	},
+}
+
+func TestKEMVectors(t *testing.T) {
+	n, _ := big.NewInt(0).SetString(kemN, 16)
+	d, _ := big.NewInt(0).SetString(kemD, 16)
+	privateKey, err := rsa.FromCryptoPrivateKey(&gorsa.PrivateKey{PublicKey: gorsa.PublicKey{N: n, E: 65537}, D: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := rsa.FromCryptoPublicKey(&gorsa.PublicKey{N: n, E: 65537})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, vector := range kemVectors {
+		z, _ := hex.DecodeString(vector.z)
+		for _, kdf := range []struct {
+			hash   crypto.Hash
+			size   int
+			secret string
+		}{{crypto.SHA256, 32, vector.secret}, {crypto.SHA384, 80, vector.secretSHA384}} {
+			secret, encapsulation, err := publicKey.EncapsulateWithKDF(bytes.NewReader(z), kdf.hash, kdf.size)
+			if err != nil {
+				t.Fatalf("vector %d: Error on Encapsulate: %v\n", i, err)
+			}
+			if hex.EncodeToString(encapsulation) != vector.encapsulation {
+				t.Fatalf("vector %d: wrong encapsulation %x", i, encapsulation)
+			}
+			if hex.EncodeToString(secret) != kdf.secret {
+				t.Fatalf("vector %d: wrong shared secret %x with %v", i, secret, kdf.hash)
+			}
+			decapsulated, err := privateKey.DecapsulateWithKDF(encapsulation, kdf.hash, kdf.size)
+			if err != nil || !bytes.Equal(decapsulated, secret) {
+				t.Fatalf("vector %d: Decapsulate doesn't return the shared secret: %v\n", i, err)
+			}
+		}
+	}
+}
+
+func TestKEM(t *testing.T) {
+	publicKey, privateKey, err := rsa.CreateRSAKey(1024, false, false)
+	if err != nil {
+		t.Fatalf("Error on RSA Key generation: %v\n", err)
+	}
+	secret, encapsulation, err := publicKey.Encapsulate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret2, encapsulation2, err := publicKey.Encapsulate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != rsa.KEMSecretLen || bytes.Equal(secret, secret2) || bytes.Equal(encapsulation, encapsulation2) {
+		t.Fatalf("Encapsulate should return random secrets of %d bytes", rsa.KEMSecretLen)
+	}
+	if decapsulated, err := privateKey.Decapsulate(encapsulation); err != nil || !bytes.Equal(decapsulated, secret) {
+		t.Fatalf("Decapsulate doesn't return the shared secret: %v\n", err)
+	}
+	if _, err := privateKey.Decapsulate(encapsulation[1:]); err == nil {
+		t.Fatalf("Decapsulate should reject an encapsulation of the wrong size")
+	}
+}
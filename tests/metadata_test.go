@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/freignat91/cipher/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileMetadata(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	dir := t.TempDir()
+	data := make([]byte, 100000)
+	rand.Read(data)
+	source := filepath.Join(dir, "report.pdf")
+	if err := ioutil.WriteFile(source, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2015, 3, 14, 15, 9, 26, 0, time.UTC)
+	if err := os.Chtimes(source, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []string{rsa.ModeRSA, rsa.ModeHybrid} {
+		name, err := rsa.RandomFileName()
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted := filepath.Join(dir, name)
+		if err := rsa.EncryptFileWithOptions(source, encrypted, path+".pub", &rsa.EncryptOptions{Mode: mode, Metadata: true}); err != nil {
+			t.Fatal(err)
+		}
+		if content, _ := ioutil.ReadFile(encrypted); bytes.Contains(content, []byte("report")) {
+			t.Fatalf("%s: the name of the file is not encrypted", mode)
+		}
+		//the metadata are not part of the data
+		decrypted := filepath.Join(dir, "decrypted")
+		if err := rsa.DecryptFile(encrypted, decrypted, path+".key"); err != nil {
+			t.Fatal(err)
+		}
+		if result, _ := ioutil.ReadFile(decrypted); !bytes.Equal(result, data) {
+			t.Fatalf("%s: decrypted file differs from the source", mode)
+		}
+		os.Remove(decrypted)
+		//the original name in a directory
+		target := filepath.Join(t.TempDir(), "restored")
+		os.Mkdir(target, 0700)
+		options := &rsa.DecryptOptions{RestoreMetadata: true}
+		if err := rsa.DecryptFileWithOptions(encrypted, target, path+".key", options); err != nil {
+			t.Fatal(err)
+		}
+		restored := filepath.Join(target, "report.pdf")
+		info, err := os.Stat(restored)
+		if err != nil {
+			t.Fatalf("%s: file not restored with its name: %v", mode, err)
+		}
+		if info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+			t.Fatalf("%s: mode %v and time %v not restored", mode, info.Mode(), info.ModTime())
+		}
+		if result, _ := ioutil.ReadFile(restored); !bytes.Equal(result, data) {
+			t.Fatalf("%s: restored file differs from the source", mode)
+		}
+		if err := rsa.DecryptFileWithOptions(encrypted, target, path+".key", options); err == nil || !strings.Contains(err.Error(), "exists") {
+			t.Fatalf("%s: an existing file shouldn't be overwritten: %v", mode, err)
+		}
+		//a target file keeps its name
+		if err := rsa.DecryptFileWithOptions(encrypted, decrypted, path+".key", options); err != nil {
+			t.Fatal(err)
+		}
+		if info, _ := os.Stat(decrypted); info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+			t.Fatalf("%s: metadata not restored on the target file", mode)
+		}
+		os.Remove(decrypted)
+	}
+}
+
+func TestFileMetadataRange(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	dir := t.TempDir()
+	data := make([]byte, 100000)
+	rand.Read(data)
+	source := filepath.Join(dir, "source")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := filepath.Join(dir, "encrypted")
+	if err := rsa.EncryptFileWithOptions(source, encrypted, path+".pub", &rsa.EncryptOptions{Metadata: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range [][2]int64{{0, 10}, {99990, -1}, {5000, 70000}} {
+		result, err := decryptRange(encrypted, path+".key", r[0], r[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		end := r[0] + r[1]
+		if r[1] < 0 {
+			end = int64(len(data))
+		}
+		if !bytes.Equal(result, data[r[0]:end]) {
+			t.Fatalf("range %v: decrypted data differ", r)
+		}
+	}
+	if _, err := decryptRange(encrypted, path+".key", 100001, 1); err == nil {
+		t.Fatalf("an offset out of the file should fail")
+	}
+	//a file without metadata
+	plain := filepath.Join(dir, "plain")
+	if err := rsa.EncryptFile(source, plain, path+".pub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.DecryptFileWithOptions(plain, t.TempDir(), path+".key", &rsa.DecryptOptions{RestoreMetadata: true}); err == nil {
+		t.Fatalf("the metadata of a file without them can't be restored")
+	}
+}
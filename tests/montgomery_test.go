@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/rand"
+	gorsa "crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+)
+
+func TestPowModuloMontgomery(t *testing.T) {
+	for _, size := range []int{8, 63, 64, 65, 127, 128, 521, 1024, 2048} {
+		for i := 0; i < 20; i++ {
+			m, _ := rand.Int(rand.Reader, big.NewInt(0).Lsh(big.NewInt(1), uint(size)))
+			m.SetBit(m, 0, 1)
+			m.SetBit(m, size-1, 1)
+			b, _ := rand.Int(rand.Reader, big.NewInt(0).Lsh(m, 3))
+			e, _ := rand.Int(rand.Reader, big.NewInt(0).Lsh(m, 1))
+			switch i {
+			case 0:
+				e.SetInt64(0)
+			case 1:
+				e.SetInt64(1)
+			case 2:
+				b.SetInt64(0)
+			case 3:
+				b.SetInt64(1)
+			}
+			expected := big.NewInt(0).Exp(b, e, m)
+			if r := rsa.PowModuloMontgomery(b, e, m); r.Cmp(expected) != 0 {
+				t.Fatalf("PowModuloMontgomery(%x, %x, %x) = %x, expected %x", b, e, m, r, expected)
+			}
+			bb := big.NewInt(0).Set(b)
+			if r := rsa.PowModulo(b, e, m); r.Cmp(expected) != 0 || b.Cmp(bb) != 0 {
+				t.Fatalf("PowModulo(%x, %x, %x) = %x, expected %x", bb, e, m, r, expected)
+			}
+		}
+	}
+}
+
+func TestEncryptDecryptMontgomery(t *testing.T) {
+	goKey, path := createGoKey(t, 2048)
+	multiPrimeKey, err := gorsa.GenerateMultiPrimeKey(rand.Reader, 3, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//keys with CRT, without primes and multi-prime
+	_, legacyKey, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []*gorsa.PrivateKey{goKey, goKey, multiPrimeKey} {
+		publicKey, err := rsa.FromCryptoPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privateKey := legacyKey
+		if i != 1 {
+			if privateKey, err = rsa.FromCryptoPrivateKey(key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		size := key.N.BitLen() / 8
+		for n := 0; n < 20; n++ {
+			m, _ := rand.Int(rand.Reader, key.N)
+			c, _ := publicKey.Encrypt(m.Bytes(), size)
+			if expected := big.NewInt(0).Exp(m, big.NewInt(int64(key.E)), key.N); expected.Cmp(big.NewInt(0).SetBytes(c)) != 0 {
+				t.Fatalf("Encrypt doesn't match math/big Exp")
+			}
+			d, _ := privateKey.DecryptRaw(c, size)
+			if m.Cmp(big.NewInt(0).SetBytes(d)) != 0 {
+				t.Fatalf("DecryptRaw doesn't match math/big Exp (key %d)", i)
+			}
+		}
+	}
+}
+
+func TestBlinding(t *testing.T) {
+	goKey, path := createGoKey(t, 2048)
+	_, privateKey, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := goKey.N.BitLen() / 8
+	for n := 0; n < 20; n++ {
+		c, _ := rand.Int(rand.Reader, goKey.N)
+		privateKey.SetBlinding(true)
+		blinded, err := privateKey.DecryptRaw(c.Bytes(), size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privateKey.SetBlinding(false)
+		unblinded, err := privateKey.DecryptRaw(c.Bytes(), size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := big.NewInt(0).Exp(c, goKey.D, goKey.N)
+		if big.NewInt(0).SetBytes(blinded).Cmp(expected) != 0 || big.NewInt(0).SetBytes(unblinded).Cmp(expected) != 0 {
+			t.Fatalf("blinded and unblinded decryptions differ")
+		}
+	}
+	//a key file without e and without public key file next to it can't be blinded
+	path = filepath.Join(t.TempDir(), "legacy.key")
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%x-%x", goKey.N, goKey.D)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	legacyKey, err := rsa.GetPrivateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := rand.Int(rand.Reader, goKey.N)
+	if _, err := legacyKey.DecryptRaw(c.Bytes(), size); err == nil {
+		t.Fatalf("a key without e should fail with blinding enabled")
+	}
+	legacyKey.SetBlinding(false)
+	if m, err := legacyKey.DecryptRaw(c.Bytes(), size); err != nil || big.NewInt(0).SetBytes(m).Cmp(big.NewInt(0).Exp(c, goKey.D, goKey.N)) != 0 {
+		t.Fatalf("a key without e should decrypt with blinding disabled: %v", err)
+	}
+	//blinding can be changed while the key is used
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 20; i++ {
+			privateKey.SetBlinding(i%2 == 0)
+		}
+		close(done)
+	}()
+	for n := 0; n < 5; n++ {
+		if _, err := privateKey.DecryptRaw(c.Bytes(), size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
+
+func TestCRTFaultCheck(t *testing.T) {
+	goKey, _ := createGoKey(t, 1024)
+	p, q := goKey.Primes[0], goKey.Primes[1]
+	//d + q-1 gives a wrong d mod p-1 and the right d mod q-1: the CRT result is only wrong modulo p, like after a
+	//fault in the exponentiation modulo p, and would reveal q
+	faultyD := big.NewInt(0).Add(goKey.D, big.NewInt(0).Sub(q, big.NewInt(1)))
+	path := filepath.Join(t.TempDir(), "faulty.key")
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%x-%x-%x-%x-%x", goKey.N, faultyD, goKey.E, p, q)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := rsa.GetPrivateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := rand.Int(rand.Reader, goKey.N)
+	for _, blinding := range []bool{true, false} {
+		privateKey.SetBlinding(blinding)
+		if m, err := privateKey.DecryptRaw(c.Bytes(), 128); err == nil {
+			t.Fatalf("a faulty CRT result should be detected (blinding %v), got %x", blinding, m)
+		}
+	}
+	hashed := sha256.Sum256([]byte("message"))
+	if _, err := privateKey.SignPKCS1v15(crypto.SHA256, hashed[:]); err == nil {
+		t.Fatalf("a faulty CRT signature should be detected")
+	}
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	gorsa "crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/freignat91/cipher/rsa"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// generate a key with crypto/rsa and save it in the cipher key format and in PEM
+func createGoKey(t *testing.T, bits int) (*gorsa.PrivateKey, string) {
+	goKey, err := gorsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("Error generating key: %v\n", err)
+	}
+	path := filepath.Join(t.TempDir(), "key")
+	if err := ioutil.WriteFile(path+".pub", []byte(fmt.Sprintf("%x-%x", goKey.N, goKey.E)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path+".key", []byte(fmt.Sprintf("%x-%x", goKey.N, goKey.D)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(goKey)})
+	if err := ioutil.WriteFile(path+".pem", data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return goKey, path
+}
+
+func TestPKCS1v15GoInterop(t *testing.T) {
+	goKey, path := createGoKey(t, 2048)
+	publicKey, privateKey, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatalf("Error reading keys: %v\n", err)
+	}
+	msg := []byte("legacy systems only speak PKCS#1 v1.5")
+	c, err := publicKey.EncryptPKCS1v15(msg)
+	if err != nil {
+		t.Fatalf("Error on EncryptPKCS1v15: %v\n", err)
+	}
+	d, err := gorsa.DecryptPKCS1v15(nil, goKey, c)
+	if err != nil || !bytes.Equal(d, msg) {
+		t.Fatalf("crypto/rsa can't decrypt: %v\n", err)
+	}
+	c, err = gorsa.EncryptPKCS1v15(rand.Reader, &goKey.PublicKey, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decrypt := range []func([]byte) ([]byte, error){privateKey.DecryptPKCS1v15, privateKey.DecryptPKCS1v15Implicit} {
+		d, err = decrypt(c)
+		if err != nil || !bytes.Equal(d, msg) {
+			t.Fatalf("Error decrypting crypto/rsa ciphertext: %v\n", err)
+		}
+	}
+	if _, err := publicKey.EncryptPKCS1v15(make([]byte, 256-10)); err == nil {
+		t.Fatalf("EncryptPKCS1v15 should reject too long messages")
+	}
+}
+
+func TestPKCS1v15ImplicitRejection(t *testing.T) {
+	_, path := createGoKey(t, 2048)
+	_, privateKey, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatalf("Error reading keys: %v\n", err)
+	}
+	bad := make([]byte, 256)
+	rand.Read(bad[1:])
+	if _, err := privateKey.DecryptPKCS1v15(bad); err != rsa.ErrDecryption {
+		t.Fatalf("DecryptPKCS1v15 should fail on a random ciphertext: %v\n", err)
+	}
+	d1, err := privateKey.DecryptPKCS1v15Implicit(bad)
+	if err != nil {
+		t.Fatalf("DecryptPKCS1v15Implicit should not report padding errors: %v\n", err)
+	}
+	d2, _ := privateKey.DecryptPKCS1v15Implicit(bad)
+	if !bytes.Equal(d1, d2) || len(d1) > 256-11 {
+		t.Fatalf("synthetic message should be deterministic and shorter than %d bytes", 256-11)
+	}
+	bad[255] ^= 1
+	d3, _ := privateKey.DecryptPKCS1v15Implicit(bad)
+	if bytes.Equal(d1, d3) {
+		t.Fatalf("synthetic message should depend on the ciphertext")
+	}
+}
+
+func TestPKCS1v15OpenSSLInterop(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+	_, path := createGoKey(t, 2048)
+	publicKey, privateKey, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatalf("Error reading keys: %v\n", err)
+	}
+	msg := []byte("single block for openssl pkeyutl")
+	c, err := publicKey.EncryptPKCS1v15(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("openssl", "pkeyutl", "-decrypt", "-inkey", path+".pem", "-pkeyopt", "rsa_padding_mode:pkcs1")
+	cmd.Stdin = bytes.NewReader(c)
+	d, err := cmd.Output()
+	if err != nil || !bytes.Equal(d, msg) {
+		t.Fatalf("openssl can't decrypt: %v\n", err)
+	}
+	cmd = exec.Command("openssl", "pkeyutl", "-encrypt", "-inkey", path+".pem", "-pkeyopt", "rsa_padding_mode:pkcs1")
+	cmd.Stdin = bytes.NewReader(msg)
+	c, err = cmd.Output()
+	if err != nil {
+		t.Fatalf("openssl encrypt: %v\n", err)
+	}
+	d, err = privateKey.DecryptPKCS1v15(c)
+	if err != nil || !bytes.Equal(d, msg) {
+		t.Fatalf("Error decrypting openssl ciphertext: %v\n", err)
+	}
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"crypto/rand"
+	"github.com/freignat91/cipher/rsa"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// records the progress given to the callback and checks it only grows
+func recordProgress(t *testing.T, last *rsa.Progress) func(rsa.Progress) {
+	return func(p rsa.Progress) {
+		if p.Bytes < last.Bytes || p.Blocks <= last.Blocks || p.Elapsed < last.Elapsed {
+			t.Errorf("progress %+v after %+v", p, *last)
+		}
+		*last = p
+	}
+}
+
+func TestProgress(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	dir := t.TempDir()
+	data := make([]byte, 10000)
+	rand.Read(data)
+	source := filepath.Join(dir, "source")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := filepath.Join(dir, "encrypted")
+	for _, options := range []rsa.EncryptOptions{{}, {Workers: 4}, {Mode: rsa.ModeHybrid}, {Compression: rsa.CompressionGzip}} {
+		var encryption, decryption rsa.Progress
+		options.Progress = recordProgress(t, &encryption)
+		if err := rsa.EncryptFileWithOptions(source, encrypted, path+".pub", &options); err != nil {
+			t.Fatal(err)
+		}
+		if encryption.Bytes != int64(len(data)) || encryption.Total != int64(len(data)) {
+			t.Fatalf("%+v: %d bytes of %d encrypted at the end, %d expected", options, encryption.Bytes, encryption.Total, len(data))
+		}
+		if options.Mode == "" && options.Compression == "" && encryption.Blocks != int64((len(data)+126)/127) {
+			t.Fatalf("%d blocks encrypted", encryption.Blocks)
+		}
+		decryptOptions := &rsa.DecryptOptions{Workers: options.Workers, Progress: recordProgress(t, &decryption)}
+		if err := rsa.DecryptFileWithOptions(encrypted, filepath.Join(dir, "decrypted"), path+".key", decryptOptions); err != nil {
+			t.Fatal(err)
+		}
+		if decryption.Bytes != int64(len(data)) || decryption.Total != int64(len(data)) || decryption.Blocks != encryption.Blocks {
+			t.Fatalf("%+v: decryption progress %+v at the end, encryption %+v", options, decryption, encryption)
+		}
+	}
+}
+
+func TestProgressETA(t *testing.T) {
+	p := rsa.Progress{Bytes: 500, Total: 2000, Elapsed: 10 * time.Second}
+	if p.Throughput() != 50 || p.ETA() != 30*time.Second {
+		t.Fatalf("throughput %f and ETA %v, 50 and 30s expected", p.Throughput(), p.ETA())
+	}
+	if p.Total = -1; p.ETA() != -1 {
+		t.Fatalf("ETA %v of an unknown size", p.ETA())
+	}
+}
@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"github.com/freignat91/cipher/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// decrypts a range of the file into memory
+func decryptRange(path string, keyPath string, offset int64, length int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	out := &bytes.Buffer{}
+	err = rsa.DecryptRangeStream(context.Background(), file, out, keyPath, offset, length, &rsa.DecryptOptions{Workers: 2})
+	return out.Bytes(), err
+}
+
+func TestDecryptRange(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	dir := t.TempDir()
+	//4 leaves of 512 blocks
+	data := make([]byte, 200000)
+	rand.Read(data)
+	source := filepath.Join(dir, "source")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []string{rsa.ModeRSA, rsa.ModeOAEP} {
+		encrypted := filepath.Join(dir, mode)
+		if err := rsa.EncryptFileWithOptions(source, encrypted, path+".pub", &rsa.EncryptOptions{Mode: mode}); err != nil {
+			t.Fatal(err)
+		}
+		ranges := [][2]int64{{0, 0}, {0, 1}, {0, -1}, {126, 2}, {127, 127}, {65000, 100}, {65023, 70000}, {199999, 10}, {150000, -1}, {200000, 5}}
+		for _, r := range ranges {
+			result, err := decryptRange(encrypted, path+".key", r[0], r[1])
+			if err != nil {
+				t.Fatalf("%s: range %v: %v", mode, r, err)
+			}
+			end := r[0] + r[1]
+			if r[1] < 0 || end > int64(len(data)) {
+				end = int64(len(data))
+			}
+			if !bytes.Equal(result, data[r[0]:end]) {
+				t.Fatalf("%s: range %v: decrypted data differ", mode, r)
+			}
+		}
+		if _, err := decryptRange(encrypted, path+".key", 200001, 1); err == nil {
+			t.Fatalf("%s: an offset out of the file should fail", mode)
+		}
+	}
+	target := filepath.Join(dir, "range")
+	if err := rsa.DecryptRange(filepath.Join(dir, rsa.ModeRSA), target, path+".key", 1000, 3000); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := ioutil.ReadFile(target); !bytes.Equal(result, data[1000:4000]) {
+		t.Fatalf("DecryptRange: decrypted file differs")
+	}
+}
+
+// returns a function computing the block tree of a file again with a new key, as anybody could if its leaves covered
+// the encrypted blocks: leaves of segment blocks of size bytes
+func forgeTree(segment int, size int) func(key []byte, header []byte, blocks []byte) []byte {
+	return func(key []byte, header []byte, blocks []byte) []byte {
+		level := [][]byte{}
+		for i := 0; i < len(blocks); i += segment * size {
+			end := i + segment*size
+			if end > len(blocks) {
+				end = len(blocks)
+			}
+			h := sha256.New()
+			h.Write([]byte{0})
+			h.Write(blocks[i:end])
+			level = append(level, h.Sum(nil))
+		}
+		section := []byte{}
+		for {
+			for _, node := range level {
+				section = append(section, node...)
+			}
+			if len(level) == 1 {
+				break
+			}
+			next := [][]byte{}
+			for i := 0; i < len(level); i += 2 {
+				if i+1 == len(level) {
+					next = append(next, level[i])
+					continue
+				}
+				h := sha256.New()
+				h.Write([]byte{1})
+				h.Write(level[i])
+				h.Write(level[i+1])
+				next = append(next, h.Sum(nil))
+			}
+			level = next
+		}
+		treeKey := hmac.New(sha256.New, key)
+		treeKey.Write([]byte("cipher block tree"))
+		tag := hmac.New(sha256.New, treeKey.Sum(nil))
+		tag.Write(header)
+		tag.Write(level[0])
+		return tag.Sum(section)
+	}
+}
+
+func TestDecryptRangeForgedTree(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	publicKey, err := rsa.GetPublicKey(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	data := make([]byte, 200000)
+	rand.Read(data)
+	encrypted := encryptDecryptFile(t, path, data, nil)
+	size := 1024 / 8
+	blocks := (len(data) + size - 2) / (size - 1)
+	body := len(encrypted) - blocks*size - 2 - 7*32 - 32 - 32
+	//the first two blocks swapped, then a new MAC key with the tree and the tag computed again
+	swapped := append([]byte(nil), encrypted[:body]...)
+	swapped = append(swapped, encrypted[body+size:body+2*size]...)
+	swapped = append(swapped, encrypted[body:body+size]...)
+	swapped = append(swapped, encrypted[body+2*size:]...)
+	file := filepath.Join(dir, "forged")
+	if err := ioutil.WriteFile(file, forgeMAC(t, swapped, publicKey, blocks, size, forgeTree(512, size)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range []int64{0, 150000} {
+		if _, err := decryptRange(file, path+".key", offset, 100); err != rsa.ErrAuthentication {
+			t.Fatalf("a range at %d of a file with a forged tree should fail with ErrAuthentication: %v", offset, err)
+		}
+	}
+	if err := rsa.DecryptFile(file, filepath.Join(dir, "decrypted"), path+".key"); err != rsa.ErrAuthentication {
+		t.Fatalf("the decryption of a file with a forged tree should fail with ErrAuthentication: %v", err)
+	}
+	if _, err := rsa.VerifyEncryptedFile(file, path+".key", nil); err == nil {
+		t.Fatalf("the verification of a file with a forged tree should fail")
+	}
+}
+
+func TestDecryptRangeTampering(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	dir := t.TempDir()
+	data := make([]byte, 200000)
+	rand.Read(data)
+	encrypted := encryptDecryptFile(t, path, data, nil)
+	size := 1024 / 8
+	blocks := (len(data) + size - 2) / (size - 1)
+	//4 leaves and 2+1 nodes, then the tags
+	body := len(encrypted) - blocks*size - 2 - 7*32 - 32 - 32
+	//a block of the third leaf
+	encrypted[body+1200*size+10] ^= 1
+	file := filepath.Join(dir, "tampered")
+	if err := ioutil.WriteFile(file, encrypted, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := decryptRange(file, path+".key", 1000, 60000); err != nil || !bytes.Equal(result, data[1000:61000]) {
+		t.Fatalf("a range out of the modified leaf should be decrypted: %v", err)
+	}
+	if _, err := decryptRange(file, path+".key", 150000, 10); err != rsa.ErrAuthentication {
+		t.Fatalf("a range in the modified leaf should fail with ErrAuthentication: %v", err)
+	}
+	if err := rsa.DecryptFile(file, filepath.Join(dir, "decrypted"), path+".key"); err != rsa.ErrAuthentication {
+		t.Fatalf("the decryption of the whole file should fail with ErrAuthentication: %v", err)
+	}
+	//files without block tree
+	for _, options := range []*rsa.EncryptOptions{{Mode: rsa.ModeHybrid}, {Compression: rsa.CompressionGzip}} {
+		other := filepath.Join(dir, "other")
+		if err := ioutil.WriteFile(other, encryptDecryptFile(t, path, data[:1000], options), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decryptRange(other, path+".key", 0, 10); err == nil {
+			t.Fatalf("%+v: a file without block tree should be refused", options)
+		}
+	}
+}
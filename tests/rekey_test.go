@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/freignat91/cipher/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRekey(t *testing.T) {
+	_, oldKey := createGoKey(t, 2048)
+	_, newKey := createGoKey(t, 2048)
+	_, otherKey := createGoKey(t, 2048)
+	dir := t.TempDir()
+	data := make([]byte, 100000)
+	rand.Read(data)
+	source := filepath.Join(t.TempDir(), "source")
+	if err := ioutil.WriteFile(source, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*rsa.EncryptOptions{
+		"rsa":          nil,
+		"oaep":         {Mode: rsa.ModeOAEP, Compression: rsa.CompressionGzip},
+		"armored":      {Armor: true},
+		"hybrid":       {Recipients: []string{otherKey + ".pub"}},
+		"hybridArmor":  {Mode: rsa.ModeHybrid, Armor: true},
+		"sub/rsa":      {Workers: 2},
+		"sub/otherKey": nil,
+	}
+	os.Mkdir(filepath.Join(dir, "sub"), 0700)
+	for name, options := range files {
+		key := oldKey
+		if name == "sub/otherKey" {
+			key = otherKey
+		}
+		if err := rsa.EncryptFileWithOptions(source, filepath.Join(dir, name), key+".pub", options); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(filepath.Join(dir, name), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ioutil.WriteFile(filepath.Join(dir, "plain"), data[:1000], 0600)
+	hybridBody := func() []byte {
+		encrypted, _ := ioutil.ReadFile(filepath.Join(dir, "hybrid"))
+		return encrypted[len(encrypted)-len(data)-2*16:]
+	}
+	before := hybridBody()
+
+	onKey, err := rsa.FilesOnKey(dir, oldKey+".key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range onKey {
+		name, _ := filepath.Rel(dir, file.Path)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if expected := []string{"armored", "hybrid", "hybridArmor", "oaep", "rsa", "sub/rsa"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("files on the old key: %v, expected %v", names, expected)
+	}
+	for _, file := range onKey {
+		if err := rsa.RekeyFile(file.Path, oldKey+".key", newKey+".pub", nil); err != nil {
+			t.Fatalf("%s: %v", file.Path, err)
+		}
+		if info, err := os.Stat(file.Path); err != nil || info.Mode().Perm() != 0640 {
+			t.Fatalf("%s: the permissions of the file should be kept: %v", file.Path, err)
+		}
+		target := filepath.Join(t.TempDir(), "decrypted")
+		if err := rsa.DecryptFile(file.Path, target, oldKey+".key"); err == nil {
+			t.Fatalf("%s: the old key shouldn't decrypt the file", file.Path)
+		}
+		if err := rsa.DecryptFile(file.Path, target, newKey+".key"); err != nil {
+			t.Fatalf("%s: %v", file.Path, err)
+		}
+		if result, _ := ioutil.ReadFile(target); !bytes.Equal(result, data) {
+			t.Fatalf("%s: decrypted file differs from the source", file.Path)
+		}
+	}
+	if onKey, _ := rsa.FilesOnKey(dir, oldKey+".key"); len(onKey) != 0 {
+		t.Fatalf("%d files still on the old key", len(onKey))
+	}
+	//hybrid: the body is not encrypted again and the other recipients are kept
+	if !bytes.Equal(before, hybridBody()) {
+		t.Fatalf("the body of the hybrid file changed")
+	}
+	if err := rsa.DecryptFile(filepath.Join(dir, "hybrid"), filepath.Join(t.TempDir(), "decrypted"), otherKey+".key"); err != nil {
+		t.Fatalf("the other recipient should still decrypt the file: %v", err)
+	}
+	if err := rsa.RekeyFile(filepath.Join(dir, "sub/otherKey"), oldKey+".key", newKey+".pub", nil); err == nil {
+		t.Fatalf("a file encrypted for another key shouldn't be rekeyed")
+	}
+}
+
+func TestRekeyTampered(t *testing.T) {
+	_, oldKey := createGoKey(t, 1024)
+	_, newKey := createGoKey(t, 1024)
+	data := make([]byte, 10000)
+	rand.Read(data)
+	encrypted := encryptDecryptFile(t, oldKey, data, nil)
+	encrypted[len(encrypted)-200] ^= 1
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tampered")
+	if err := ioutil.WriteFile(file, encrypted, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.RekeyFile(file, oldKey+".key", newKey+".pub", nil); err != rsa.ErrAuthentication {
+		t.Fatalf("rekey of a modified file should fail with ErrAuthentication: %v", err)
+	}
+	if after, _ := ioutil.ReadFile(file); !bytes.Equal(after, encrypted) {
+		t.Fatalf("the file changed after a failed rekey")
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.tmp*")); len(files) > 0 {
+		t.Fatalf("%v left after a failed rekey", files)
+	}
+}
+
+func TestFilesOnKeyDamaged(t *testing.T) {
+	_, key := createGoKey(t, 1024)
+	dir := t.TempDir()
+	data := make([]byte, 1000)
+	rand.Read(data)
+	encrypted := encryptDecryptFile(t, key, data, nil)
+	for _, name := range []string{"a", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), encrypted, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//starts as a cipher file, the header is cut
+	if err := ioutil.WriteFile(filepath.Join(dir, "b"), encrypted[:20], 0600); err != nil {
+		t.Fatal(err)
+	}
+	files, err := rsa.FilesOnKey(dir, key+".key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || files[0].Err != nil || files[1].Err == nil || files[2].Err != nil {
+		t.Fatalf("the damaged file should be returned with its error and the walk go on: %+v", files)
+	}
+	if files[1].Path != filepath.Join(dir, "b") || files[2].Path != filepath.Join(dir, "c") {
+		t.Fatalf("wrong files %+v", files)
+	}
+}
@@ -38,7 +38,7 @@ func TestRSA(t *testing.T) {
 	for nn := 0; nn < 1000; nn++ {
 		rand.Read(list)
 		c, _ := publicKey.Encrypt(list, size+1)
-		d, _ := privateKey.Decrypt(c, size)
+		d, _ := privateKey.DecryptRaw(c, size)
 		if len(list) != len(d) {
 			t.Fatalf("Error on RSA Decrypt")
 		}
@@ -0,0 +1,22 @@
+//go:build sidechannel
+
+package tests
+
+import (
+	"github.com/freignat91/cipher/rsa"
+	"testing"
+)
+
+// go test -tags sidechannel -run SideChannel ./tests, several minutes
+func TestSideChannel(t *testing.T) {
+	results, err := rsa.RunTimingTests(1024, 20000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		t.Logf("%-28s |t|=%.2f (percentile %d) fixed=%v random=%v", result.Name, result.T, result.Percentile, result.FixedMean, result.RandomMean)
+		if result.ConstantTime && result.Leaky() {
+			t.Errorf("%s: time depends on the input, |t| = %.2f", result.Name, result.T)
+		}
+	}
+}
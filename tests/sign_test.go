@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/rand"
+	gorsa "crypto/rsa"
+	"github.com/freignat91/cipher/rsa"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignGoInterop(t *testing.T) {
+	goKey, path := createGoKey(t, 2048)
+	publicKey, privateKey, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatalf("Error reading keys: %v\n", err)
+	}
+	for _, hash := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		h := hash.New()
+		h.Write([]byte("release artifact"))
+		digest := h.Sum(nil)
+		for _, opts := range []crypto.SignerOpts{hash, &gorsa.PSSOptions{Hash: hash}, &gorsa.PSSOptions{Hash: hash, SaltLength: gorsa.PSSSaltLengthEqualsHash}} {
+			sig, err := privateKey.Sign(nil, digest, opts)
+			if err != nil {
+				t.Fatalf("Error signing %v: %v\n", hash, err)
+			}
+			if pssOpts, ok := opts.(*gorsa.PSSOptions); ok {
+				err = gorsa.VerifyPSS(&goKey.PublicKey, hash, digest, sig, pssOpts)
+			} else {
+				err = gorsa.VerifyPKCS1v15(&goKey.PublicKey, hash, digest, sig)
+			}
+			if err != nil {
+				t.Fatalf("crypto/rsa can't verify %v signature: %v\n", hash, err)
+			}
+			if sig, err = goKey.Sign(rand.Reader, digest, opts); err != nil {
+				t.Fatal(err)
+			}
+			if err := publicKey.Verify(digest, sig, opts); err != nil {
+				t.Fatalf("Error verifying crypto/rsa %v signature: %v\n", hash, err)
+			}
+			sig[len(sig)/2] ^= 1
+			if err := publicKey.Verify(digest, sig, opts); err == nil {
+				t.Fatalf("Verify should reject a modified signature")
+			}
+		}
+	}
+}
+
+func TestSignFile(t *testing.T) {
+	_, path := createGoKey(t, 2048)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "artifact")
+	sig := filepath.Join(dir, "artifact.sig")
+	if err := ioutil.WriteFile(file, []byte("release artifact content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, scheme := range []string{rsa.SchemePSS, rsa.SchemePKCS1v15} {
+		if err := rsa.SignFile(file, sig, path+".key", scheme, crypto.SHA384); err != nil {
+			t.Fatalf("Error on SignFile: %v\n", err)
+		}
+		if err := rsa.VerifyFile(file, sig, path+".pub", scheme, crypto.SHA384); err != nil {
+			t.Fatalf("Error on VerifyFile: %v\n", err)
+		}
+		if err := rsa.VerifyFile(file, sig, path+".pub", scheme, crypto.SHA256); err == nil {
+			t.Fatalf("VerifyFile should fail with another hash")
+		}
+	}
+	if err := ioutil.WriteFile(file, []byte("modified artifact content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyFile(file, sig, path+".pub", rsa.SchemePKCS1v15, crypto.SHA384); err == nil {
+		t.Fatalf("VerifyFile should fail on a modified file")
+	}
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"github.com/freignat91/cipher/rsa"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStream(t *testing.T) {
+	_, path := createGoKey(t, 2048)
+	publicKey, privateKey, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []string{rsa.ModeRSA, rsa.ModeOAEP, rsa.ModeHybrid} {
+		for _, size := range []int{0, 1, 255, 1000, 64*1024 + 3, 200000} {
+			data := make([]byte, size)
+			rand.Read(data)
+			encrypted := &bytes.Buffer{}
+			w, err := rsa.NewEncryptWriterWithOptions(encrypted, []*rsa.PublicKey{publicKey}, &rsa.EncryptOptions{Mode: mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			//writes of any size
+			for written, n := 0, 1; written < size; n = n*3 + 1 {
+				if written+n > size {
+					n = size - written
+				}
+				if _, err := w.Write(data[written : written+n]); err != nil {
+					t.Fatal(err)
+				}
+				written += n
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			//short reads on the encrypted stream
+			for _, source := range []io.Reader{bytes.NewReader(encrypted.Bytes()), iotest.HalfReader(bytes.NewReader(encrypted.Bytes())), iotest.OneByteReader(bytes.NewReader(encrypted.Bytes()))} {
+				r, err := rsa.NewDecryptReader(source, privateKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result, err := ioutil.ReadAll(iotest.HalfReader(r))
+				if err != nil {
+					t.Fatalf("Error decrypting %d bytes in %s mode: %v\n", size, mode, err)
+				}
+				if !bytes.Equal(result, data) {
+					t.Fatalf("decrypted stream differs from the source (%d bytes in %s mode)", size, mode)
+				}
+			}
+			//truncated stream
+			if size > 0 {
+				r, err := rsa.NewDecryptReader(bytes.NewReader(encrypted.Bytes()[:encrypted.Len()-1]), privateKey)
+				if err == nil {
+					_, err = ioutil.ReadAll(r)
+				}
+				if err == nil {
+					t.Fatalf("a truncated stream should fail (%d bytes in %s mode)", size, mode)
+				}
+			}
+		}
+	}
+}
+
+func TestParallelStream(t *testing.T) {
+	_, path := createGoKey(t, 1024)
+	publicKey, privateKey, err := rsa.GetKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 300000)
+	rand.Read(data)
+	for _, mode := range []string{rsa.ModeRSA, rsa.ModeOAEP, rsa.ModeHybrid} {
+		for _, workers := range []int{1, 2, 8} {
+			encrypted := &bytes.Buffer{}
+			w, err := rsa.NewEncryptWriterContext(context.Background(), encrypted, []*rsa.PublicKey{publicKey}, &rsa.EncryptOptions{Mode: mode, Workers: workers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.Copy(w, iotest.HalfReader(bytes.NewReader(data))); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			r, err := rsa.NewDecryptReaderContext(context.Background(), bytes.NewReader(encrypted.Bytes()), privateKey, &rsa.DecryptOptions{Workers: workers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("Error decrypting in %s mode with %d workers: %v\n", mode, workers, err)
+			}
+			if !bytes.Equal(result, data) {
+				t.Fatalf("decrypted stream differs from the source in %s mode with %d workers", mode, workers)
+			}
+			//a corrupted block in the middle is reported
+			corrupted := append([]byte(nil), encrypted.Bytes()...)
+			corrupted[len(corrupted)/2] ^= 1
+			r, err = rsa.NewDecryptReaderContext(context.Background(), bytes.NewReader(corrupted), privateKey, &rsa.DecryptOptions{Workers: workers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result, err := ioutil.ReadAll(r); err == nil && bytes.Equal(result, data) {
+				t.Fatalf("a corrupted stream shouldn't decrypt to the source in %s mode with %d workers", mode, workers)
+			}
+			//cancellation
+			ctx, cancel := context.WithCancel(context.Background())
+			r, err = rsa.NewDecryptReaderContext(ctx, bytes.NewReader(encrypted.Bytes()), privateKey, &rsa.DecryptOptions{Workers: workers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.Read(make([]byte, 10)); err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+			if _, err := ioutil.ReadAll(r); err != context.Canceled {
+				t.Fatalf("expected %v after cancellation, got %v", context.Canceled, err)
+			}
+			w, err = rsa.NewEncryptWriterContext(ctx, ioutil.Discard, []*rsa.PublicKey{publicKey}, &rsa.EncryptOptions{Mode: mode, Workers: workers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = w.Write(data)
+			if errc := w.Close(); err == nil {
+				err = errc
+			}
+			if err != context.Canceled {
+				t.Fatalf("expected %v writing after cancellation, got %v", context.Canceled, err)
+			}
+		}
+	}
+}
+
+func TestStreamFunctions(t *testing.T) {
+	_, path := createGoKey(t, 2048)
+	data := make([]byte, 100000)
+	rand.Read(data)
+	file := filepath.Join(t.TempDir(), "source")
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	filei, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filei.Close()
+	//a file already partly read: its size is recorded in the header minus the data read
+	if _, err := filei.Seek(10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range []struct {
+		r    io.Reader
+		data []byte
+	}{{filei, data[10:]}, {bytes.NewReader(data), data}} {
+		for _, options := range []*rsa.EncryptOptions{nil, {Mode: rsa.ModeHybrid, Compression: rsa.CompressionAuto}, {Armor: true}} {
+			if f, ok := source.r.(*os.File); ok {
+				f.Seek(10, io.SeekStart)
+			}
+			if r, ok := source.r.(*bytes.Reader); ok {
+				r.Seek(0, io.SeekStart)
+			}
+			encrypted := &bytes.Buffer{}
+			if err := rsa.EncryptStreamContext(context.Background(), source.r, encrypted, path+".pub", options); err != nil {
+				t.Fatal(err)
+			}
+			decrypted := &bytes.Buffer{}
+			if err := rsa.DecryptStreamContext(context.Background(), encrypted, decrypted, path+".key", nil); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decrypted.Bytes(), source.data) {
+				t.Fatalf("decrypted stream differs from the source (%d bytes, %d expected)", decrypted.Len(), len(source.data))
+			}
+		}
+	}
+}